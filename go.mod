@@ -11,3 +11,5 @@ require (
 require golang.org/x/crypto v0.40.0
 
 require github.com/golang-jwt/jwt/v5 v5.3.0
+
+require golang.org/x/sys v0.34.0 // indirect
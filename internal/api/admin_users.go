@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+const maxSuspensionReasonLength = 500
+
+// likeEscaper escapes the wildcards of LIKE patterns, so that searching for
+// "a_b" does not also match "axb".
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func adminUserFromDatabase(dbUser database.User) AdminUser {
+	user := AdminUser{
+		ID:               dbUser.ID,
+		CreatedAt:        dbUser.CreatedAt,
+		UpdatedAt:        dbUser.UpdatedAt,
+		Email:            dbUser.Email,
+		IsChirpyRed:      dbUser.IsChirpyRed,
+		EmailVerified:    dbUser.EmailVerifiedAt.Valid,
+		TwoFactorEnabled: dbUser.TotpEnabled,
+		SuspensionReason: dbUser.SuspensionReason.String,
+	}
+	if dbUser.SuspendedAt.Valid {
+		user.SuspendedAt = &dbUser.SuspendedAt.Time
+	}
+	return user
+}
+
+// ListUsers lists users, newest first, paginated with "limit" and "cursor".
+// They can be filtered with "email" (a case-insensitive substring),
+// "is_chirpy_red" and "suspended" (true or false), and "created_since" and
+// "created_until" (RFC 3339 timestamps).
+func (config *APIConfig) ListUsers(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListUsersParams{Limit: int32(limit + 1)}
+	if email := query.Get("email"); email != "" {
+		params.Email = sql.NullString{String: likeEscaper.Replace(email), Valid: true}
+	}
+	for _, filter := range []struct {
+		name  string
+		value *sql.NullBool
+	}{
+		{"is_chirpy_red", &params.IsChirpyRed},
+		{"suspended", &params.Suspended},
+	} {
+		value := query.Get(filter.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid "+filter.name+", expected true or false")
+			return
+		}
+		*filter.value = sql.NullBool{Bool: parsed, Valid: true}
+	}
+	for _, filter := range []struct {
+		name  string
+		value *sql.NullTime
+	}{
+		{"created_since", &params.CreatedSince},
+		{"created_until", &params.CreatedUntil},
+	} {
+		value := query.Get(filter.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid "+filter.name+" format, expected RFC 3339")
+			return
+		}
+		*filter.value = sql.NullTime{Time: parsed.UTC(), Valid: true}
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbUsers, err := config.Queries.ListUsers(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+	if len(dbUsers) > limit {
+		dbUsers = dbUsers[:limit]
+		last := dbUsers[len(dbUsers)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	users := make([]AdminUser, 0, len(dbUsers))
+	for _, dbUser := range dbUsers {
+		users = append(users, adminUserFromDatabase(dbUser))
+	}
+	respondWithJSON(writer, http.StatusOK, users)
+}
+
+// GetUser returns the user in the path with their roles.
+func (config *APIConfig) GetUser(writer http.ResponseWriter, request *http.Request) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	user := adminUserFromDatabase(dbUser)
+	user.Roles, err = config.userRoles(userID)
+	if err != nil {
+		log.Printf("Failed to list roles of user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, user)
+}
+
+// SuspendUser stops the user in the path from logging in or using any
+// authenticated endpoint, and signs them out of every device. The request
+// body may give a "reason". Suspending a suspended user only updates the
+// reason.
+func (config *APIConfig) SuspendUser(writer http.ResponseWriter, request *http.Request) {
+	type SuspendRequest struct {
+		Reason string `json:"reason"`
+	}
+
+	userID, ok := parseTargetUser(writer, request, "suspend")
+	if !ok {
+		return
+	}
+
+	var suspendRequest SuspendRequest
+	err := json.NewDecoder(request.Body).Decode(&suspendRequest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	reason := strings.TrimSpace(suspendRequest.Reason)
+	if len(reason) > maxSuspensionReasonLength {
+		respondWithError(writer, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+	defer tx.Rollback()
+
+	dbUser, err := suspendUser(config.Queries.WithTx(tx), userID, reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Failed to suspend user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+	log.Printf("User %v suspended: %q", userID, reason)
+	respondWithJSON(writer, http.StatusOK, adminUserFromDatabase(dbUser))
+}
+
+// suspendUser marks the user as suspended and revokes their refresh tokens.
+// Their access tokens are refused by RequireAuth from then on. Run it in a
+// transaction so that both happen or neither does.
+func suspendUser(queries *database.Queries, userID uuid.UUID, reason string) (database.User, error) {
+	dbUser, err := queries.SuspendUser(context.Background(), database.SuspendUserParams{
+		ID:               userID,
+		SuspensionReason: sql.NullString{String: reason, Valid: reason != ""},
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return dbUser, queries.RevokeAllRefreshTokensForUser(context.Background(), userID)
+}
+
+// UnsuspendUser lets the user in the path log in again.
+func (config *APIConfig) UnsuspendUser(writer http.ResponseWriter, request *http.Request) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	dbUser, err := config.Queries.UnsuspendUser(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to unsuspend user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to unsuspend user")
+		return
+	}
+	log.Printf("User %v unsuspended", userID)
+	respondWithJSON(writer, http.StatusOK, adminUserFromDatabase(dbUser))
+}
+
+// ForceLogoutUser revokes every refresh token of the user in the path. Their
+// access tokens keep working until they expire, within the hour.
+func (config *APIConfig) ForceLogoutUser(writer http.ResponseWriter, request *http.Request) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	_, err = config.Queries.GetUserById(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+
+	err = config.Queries.RevokeAllRefreshTokensForUser(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to revoke sessions of user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	log.Printf("User %v signed out of every device", userID)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser deletes the user in the path along with everything they own:
+// chirps, likes, follows, sessions and tokens.
+func (config *APIConfig) DeleteUser(writer http.ResponseWriter, request *http.Request) {
+	userID, ok := parseTargetUser(writer, request, "delete")
+	if !ok {
+		return
+	}
+
+	deleted, err := config.Queries.DeleteUser(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to delete user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	log.Printf("User %v deleted", userID)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// parseTargetUser reads the user ID from the path and refuses it when it is
+// the caller's own, so that an admin cannot lock themselves out. When it
+// returns false an error response has already been written.
+func parseTargetUser(writer http.ResponseWriter, request *http.Request, action string) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return uuid.Nil, false
+	}
+	if principal, ok := PrincipalFromContext(request.Context()); ok && principal.UserID == userID {
+		respondWithError(writer, http.StatusBadRequest, "You cannot "+action+" your own account")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+)
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+	errSuspended    = errors.New("account is suspended")
+)
+
+// Principal is the user a request acts for, as resolved by RequireAuth or
+// OptionalAuth from its bearer token.
+type Principal struct {
+	UserID uuid.UUID
+	// PersonalAccessToken is true when the request authenticated with a
+	// personal access token rather than a login, and Scopes lists what the
+	// token was granted.
+	PersonalAccessToken bool
+	Scopes              []string
+	// Roles lists the roles carried by the access token. Personal access
+	// tokens carry none, so they never get more than a regular user.
+	Roles []string
+}
+
+// HasScope reports whether the principal may act within scope. Logins may do
+// anything; personal access tokens only what they were granted.
+func (principal Principal) HasScope(scope auth.Scope) bool {
+	return !principal.PersonalAccessToken || auth.HasScope(principal.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// HasPermission reports whether one of the principal's roles allows
+// permission.
+func (principal Principal) HasPermission(permission auth.Permission) bool {
+	return !principal.PersonalAccessToken && auth.HasPermission(principal.Roles, permission)
+}
+
+// PrincipalFromContext returns the principal stored by RequireAuth or
+// OptionalAuth, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// RequireAuth only lets requests with a valid access token or personal access
+// token through, and stores their principal in the request context. Others
+// get a 401 with a WWW-Authenticate challenge, or a 403 when the account is
+// suspended.
+func (config *APIConfig) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		principal, err := config.resolvePrincipal(request)
+		if errors.Is(err, errMissingToken) || errors.Is(err, errInvalidToken) {
+			log.Printf("Rejected request to %s: %v", request.URL.Path, err)
+			respondUnauthorized(writer, err)
+			return
+		}
+		if errors.Is(err, errSuspended) {
+			respondWithError(writer, http.StatusForbidden, "Account is suspended")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to authenticate request: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to check token")
+			return
+		}
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), principalKey{}, principal)))
+	})
+}
+
+// OptionalAuth stores the principal of requests with a valid token in the
+// request context, like RequireAuth, but lets every request through.
+// Anonymous requests, requests with a token that does not validate and
+// requests from suspended accounts are treated the same.
+func (config *APIConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		principal, err := config.resolvePrincipal(request)
+		if err != nil {
+			if !errors.Is(err, errMissingToken) && !errors.Is(err, errInvalidToken) && !errors.Is(err, errSuspended) {
+				log.Printf("Failed to authenticate request: %v", err)
+			}
+			next.ServeHTTP(writer, request)
+			return
+		}
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), principalKey{}, principal)))
+	})
+}
+
+// RequirePermission only lets through requests whose principal has one of the
+// roles allowing permission, and answers the others with a 403. It expects
+// RequireAuth to have run.
+func (config *APIConfig) RequirePermission(permission auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		principal, ok := PrincipalFromContext(request.Context())
+		if !ok {
+			respondUnauthorized(writer, errMissingToken)
+			return
+		}
+		if !principal.HasPermission(permission) {
+			log.Printf("Denied %s to user %s: missing the %s permission", request.URL.Path, principal.UserID, permission)
+			respondWithError(writer, http.StatusForbidden, "You do not have permission to do this")
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// resolvePrincipal validates the bearer token of the request and checks that
+// its user may still use the API. It fails with errMissingToken or
+// errInvalidToken when the request is not authenticated, with errSuspended
+// when the account is suspended, and with other errors when the token could
+// not be checked.
+func (config *APIConfig) resolvePrincipal(request *http.Request) (Principal, error) {
+	principal, err := config.principalFromToken(request)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	// Access tokens stay valid for an hour, so suspensions and deletions are
+	// checked on every request rather than when tokens are issued.
+	suspendedAt, err := config.Queries.GetUserSuspension(context.Background(), principal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, fmt.Errorf("%w: user %v no longer exists", errInvalidToken, principal.UserID)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if suspendedAt.Valid {
+		return Principal{}, errSuspended
+	}
+	return principal, nil
+}
+
+// principalFromToken resolves the bearer token of the request to the
+// principal it was issued to.
+func (config *APIConfig) principalFromToken(request *http.Request) (Principal, error) {
+	if request.Header.Get("Authorization") == "" {
+		return Principal{}, errMissingToken
+	}
+	token, err := auth.GetBearerToken(request.Header)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	if !auth.IsPersonalAccessToken(token) {
+		userID, roles, err := config.JWTKeys.ValidateJWT(token)
+		if err != nil {
+			return Principal{}, fmt.Errorf("%w: %v", errInvalidToken, err)
+		}
+		return Principal{UserID: userID, Roles: roles}, nil
+	}
+
+	pat, err := config.Queries.UsePersonalAccessToken(context.Background(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, fmt.Errorf("%w: unknown, expired or revoked personal access token", errInvalidToken)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{UserID: pat.UserID, PersonalAccessToken: true, Scopes: pat.Scopes}, nil
+}
+
+// respondUnauthorized writes the 401 response shared by every endpoint that
+// needs authentication, with the RFC 6750 challenge.
+func respondUnauthorized(writer http.ResponseWriter, err error) {
+	challenge := `Bearer realm="chirpy"`
+	if errors.Is(err, errInvalidToken) {
+		challenge += `, error="invalid_token"`
+	}
+	writer.Header().Set("WWW-Authenticate", challenge)
+	respondWithError(writer, http.StatusUnauthorized, "Invalid or missing token")
+}
+
+// requireLogin returns the ID of the user a request acts for, and refuses
+// personal access tokens: endpoints managing the account itself need a
+// login. It expects RequireAuth to have run. When it returns false an error
+// response has already been written.
+func requireLogin(writer http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
+	principal, ok := PrincipalFromContext(request.Context())
+	if !ok {
+		respondUnauthorized(writer, errMissingToken)
+		return uuid.Nil, false
+	}
+	if principal.PersonalAccessToken {
+		respondWithError(writer, http.StatusForbidden, "Personal access tokens cannot use this endpoint")
+		return uuid.Nil, false
+	}
+	return principal.UserID, true
+}
+
+// requireScope returns the principal of a request if it may act within
+// scope. It expects RequireAuth to have run. When it returns false an error
+// response has already been written.
+func requireScope(writer http.ResponseWriter, request *http.Request, scope auth.Scope) (Principal, bool) {
+	principal, ok := PrincipalFromContext(request.Context())
+	if !ok {
+		respondUnauthorized(writer, errMissingToken)
+		return Principal{}, false
+	}
+	if !principal.HasScope(scope) {
+		respondWithError(writer, http.StatusForbidden, fmt.Sprintf("Token lacks the %s scope", scope))
+		return Principal{}, false
+	}
+	return principal, true
+}
+
+// viewerID returns the ID of the caller when OptionalAuth found a login, or a
+// personal access token with the chirps:read scope, and an empty NullUUID
+// otherwise.
+func viewerID(request *http.Request) uuid.NullUUID {
+	principal, ok := PrincipalFromContext(request.Context())
+	if !ok || !principal.HasScope(auth.ScopeChirpsRead) {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: principal.UserID, Valid: true}
+}
+
+// HandleJWKS serves the public keys that verify access tokens, so that other
+// services can check them without sharing a secret with Chirpy.
+func (config *APIConfig) HandleJWKS(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(writer, http.StatusOK, config.JWTKeys.JWKS())
+}
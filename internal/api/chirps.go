@@ -2,11 +2,11 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"sort"
 
 	"github.com/google/uuid"
 	"github.com/jrmts/Chrispy/internal/auth"
@@ -18,7 +18,9 @@ import (
 //	is was called validateChirp, but it was not used in the latest code
 func (config *APIConfig) Chirps(writer http.ResponseWriter, request *http.Request) {
 	type ChirpRequest struct {
-		Body string `json:"body"`
+		Body      string     `json:"body"`
+		InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+		QuoteOf   *uuid.UUID `json:"quote_of,omitempty"`
 		// UserId string `json:"user_id"`
 	}
 	if request.Method != http.MethodPost {
@@ -26,31 +28,32 @@ func (config *APIConfig) Chirps(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	token, err := auth.GetBearerToken(request.Header)
-	if err != nil {
-		respondWithError(writer, http.StatusUnauthorized, "Invalid or missing token")
+	caller, ok := requireScope(writer, request, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
-
-	userID, err := auth.ValidateJWT(token, config.SecretKey)
-	if err != nil {
-		log.Printf("Failed to vallidate token: %v", err)
-		respondWithError(writer, http.StatusUnauthorized, "Invalid token")
+	userID := caller.UserID
+	if !config.requireVerifiedEmail(writer, userID) {
 		return
 	}
 
 	decoder := json.NewDecoder(request.Body)
 	var chirpRequest ChirpRequest
-	err = decoder.Decode(&chirpRequest)
+	err := decoder.Decode(&chirpRequest)
 	if err != nil {
 		respondWithError(writer, http.StatusBadRequest, "Chirp must be a valid JSON object")
 		return
 	}
 
-	if len(chirpRequest.Body) > 140 {
+	checked, err := config.checkChirpBody(chirpRequest.Body)
+	if err != nil {
 		respondWithError(writer, http.StatusBadRequest, "Chirp is too long.")
 		return
 	}
+	if checked.Rejected {
+		respondWithError(writer, http.StatusUnprocessableEntity, "Chirp contains words that are not allowed")
+		return
+	}
 
 	// save the chirp to the database
 	// userId, err := uuid.Parse(chirpRequest.UserId)
@@ -72,9 +75,40 @@ func (config *APIConfig) Chirps(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	dbChirp, err := config.Queries.CreateChirp(context.Background(), database.CreateChirpParams{
-		UserID: userID,
-		Body:   badWordReplace(chirpRequest.Body), //chirpRequest.Body,
+	var inReplyTo uuid.NullUUID
+	if chirpRequest.InReplyTo != nil {
+		parent, err := config.getVisibleChirp(request, *chirpRequest.InReplyTo)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Chirp being replied to does not exist")
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	var quoteOf uuid.NullUUID
+	if chirpRequest.QuoteOf != nil {
+		quoted, err := config.getVisibleOriginal(request, *chirpRequest.QuoteOf)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Quoted chirp does not exist")
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create chirp")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	dbChirp, err := queries.CreateChirp(context.Background(), database.CreateChirpParams{
+		UserID:    userID,
+		Body:      checked.Body,
+		InReplyTo: inReplyTo,
+		QuoteOf:   quoteOf,
 	})
 	if err != nil {
 		log.Printf("Failed to create chirp: %v", err)
@@ -82,124 +116,110 @@ func (config *APIConfig) Chirps(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	chirp := Chirp{
-		ID:        dbChirp.ID,
-		UserID:    dbChirp.UserID,
-		Body:      dbChirp.Body,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
+	err = saveChirpEntities(queries, dbChirp)
+	if err != nil {
+		log.Printf("Failed to save chirp entities: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create chirp")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit chirp: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create chirp")
+		return
+	}
+
+	if checked.Flagged {
+		config.flagChirp(dbChirp.ID, checked)
+	}
+
+	chirps, err := config.chirpsFromDatabase([]database.Chirp{dbChirp}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to load created chirp")
+		return
 	}
+	chirp := chirps[0]
 
 	log.Printf("Chirp created successfully: %v", chirp)
 	respondWithJSON(writer, http.StatusCreated, chirp)
 }
 
-// get chirps retrieves all chirps for a user.
+// GetChirps lists chirps, optionally filtered by author. Results are ordered
+// by creation time ("sort" is "asc" or "desc") and paginated with "limit" and
+// an opaque "cursor"; the URL of the next page is returned in the Link header.
 func (config *APIConfig) GetChirps(writer http.ResponseWriter, request *http.Request) {
-	// type ChirpRequest struct {
-	// 	// Body     string `json:"body"`
-	// 	AuthorID string `json:"author_id,omitempty"` // Optional field for author ID
-	// 	// UserId string `json:"user_id"`
-	// }
-
 	if request.Method != http.MethodGet {
 		respondWithError(writer, http.StatusMethodNotAllowed, "Chirps must be a GET request")
 		return
 	}
 
-	// decoder := json.NewDecoder(request.Body)
-	// var chirpRequestWithAuthor ChirpRequest
-	// err := decoder.Decode(&chirpRequestWithAuthor)
-	// if err != nil {
-	// 	respondWithError(writer, http.StatusBadRequest, "Chirp must be a valid JSON object")
-	// 	return
-	// }
+	query := request.URL.Query()
+	sortOrder := query.Get("sort")
+	if sortOrder != "" && sortOrder != "asc" && sortOrder != "desc" {
+		respondWithError(writer, http.StatusBadRequest, "Invalid sort value, expected 'asc' or 'desc'")
+		return
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	//s := r.URL.Query().Get("author_id")
-	authorID := request.URL.Query().Get("author_id")
-	sortOrder := request.URL.Query().Get("sort")
+	params := database.ListChirpsAscParams{
+		Limit: int32(limit + 1),
+	}
+
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
 
-	if authorID != "" {
-		authorID, err := uuid.Parse(authorID)
+	if authorID := query.Get("author_id"); authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
 			respondWithError(writer, http.StatusBadRequest, "Invalid author_id format")
 			return
 		}
 
 		// Check if the author exists
-		_, err = config.Queries.GetUserById(context.Background(), authorID)
+		_, err = config.Queries.GetUserById(context.Background(), authorUUID)
 		if err != nil {
 			respondWithError(writer, http.StatusBadRequest, "Author does not exist")
 			return
 		}
+		params.AuthorID = uuid.NullUUID{UUID: authorUUID, Valid: true}
+	}
 
-		dbChirps, err := config.Queries.GetChirpByAuthorID(context.Background(), authorID)
-		if err != nil {
-			log.Printf("Failed to get chirps by author ID: %v", err)
-			respondWithError(writer, http.StatusInternalServerError, fmt.Sprintf("Failed to get chirps by author ID: %v", err))
-			return
-		}
-		var chirps []Chirp
-		for _, dbChirp := range dbChirps {
-			chirp := Chirp{
-				ID:        dbChirp.ID,
-				UserID:    dbChirp.UserID,
-				Body:      dbChirp.Body,
-				CreatedAt: dbChirp.CreatedAt,
-				UpdatedAt: dbChirp.UpdatedAt,
-			}
-			chirps = append(chirps, chirp)
-		}
-		log.Printf("Chirps retrieved successfully: %v", chirps)
-		if sortOrder == "asc" || sortOrder == "" {
-			sort.Slice(chirps, func(i, j int) bool {
-				return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-				//a[i].CreatedAt.Before(a[j].CreatedAt)
-			})
-		}
-		if sortOrder == "desc" {
-			sort.Slice(chirps, func(i, j int) bool {
-				return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-				//a[i].CreatedAt.After(a[j].CreatedAt)
-			})
-		}
-		respondWithJSON(writer, http.StatusOK, chirps)
+	var dbChirps []database.Chirp
+	if sortOrder == "desc" {
+		dbChirps, err = config.Queries.ListChirpsDesc(context.Background(), database.ListChirpsDescParams(params))
 	} else {
-		// If no author ID is provided, get all chirps
+		dbChirps, err = config.Queries.ListChirpsAsc(context.Background(), params)
+	}
+	if err != nil {
+		log.Printf("Failed to get chirps: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, fmt.Sprintf("Failed to get chirps: %v", err))
+		return
+	}
 
-		dbChirps, err := config.Queries.GetAllChirps(context.Background())
-		if err != nil {
-			log.Printf("Failed to get chirps: %v", err)
-			respondWithError(writer, http.StatusInternalServerError, fmt.Sprintf("Failed to get chirps: %v", err))
-			return
-		}
-		// Convert sliceOfChirps to a slice of Chirp structs
-		var chirps []Chirp
-		for _, dbChirp := range dbChirps {
-			chirp := Chirp{
-				ID:        dbChirp.ID,
-				UserID:    dbChirp.UserID,
-				Body:      dbChirp.Body,
-				CreatedAt: dbChirp.CreatedAt,
-				UpdatedAt: dbChirp.UpdatedAt,
-			}
-			chirps = append(chirps, chirp)
-		}
-		if sortOrder == "asc" || sortOrder == "" {
-			sort.Slice(chirps, func(i, j int) bool {
-				return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-				//a[i].CreatedAt.Before(a[j].CreatedAt)
-			})
-		}
-		if sortOrder == "desc" {
-			sort.Slice(chirps, func(i, j int) bool {
-				return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-				//a[i].CreatedAt.After(a[j].CreatedAt)
-			})
-		}
-		log.Printf("Chirps retrieved successfully: %v", chirps)
-		respondWithJSON(writer, http.StatusOK, chirps)
+	if len(dbChirps) > limit {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[len(dbChirps)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
 	}
+
+	chirps, err := config.chirpsFromDatabase(dbChirps, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get chirps")
+		return
+	}
+	log.Printf("Chirps retrieved successfully: %d", len(chirps))
+	respondWithJSON(writer, http.StatusOK, chirps)
 }
 
 // GetChirpByID retrieves a chirp by its ID.
@@ -224,13 +244,17 @@ func (config *APIConfig) GetChirpByID(writer http.ResponseWriter, request *http.
 		respondWithError(writer, http.StatusNotFound, fmt.Sprintf("Failed to get chirp by ID: %v", err))
 		return
 	}
-	chirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		UserID:    dbChirp.UserID,
-		Body:      dbChirp.Body,
+	if !canSeeChirp(request, dbChirp) {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
 	}
+	chirps, err := config.chirpsFromDatabase([]database.Chirp{dbChirp}, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get chirp")
+		return
+	}
+	chirp := chirps[0]
 	log.Printf("Chirp recieved successfully: %v", chirp)
 	respondWithJSON(writer, http.StatusOK, chirp)
 }
@@ -241,18 +265,11 @@ func (config *APIConfig) DeleteOneChirp(writer http.ResponseWriter, request *htt
 		return
 	}
 
-	requestUserToken, err := auth.GetBearerToken(request.Header)
-	if err != nil {
-		respondWithError(writer, http.StatusUnauthorized, "Invalid or missing token")
-		return
-	}
-
-	requestUserUUID, err := auth.ValidateJWT(requestUserToken, config.SecretKey)
-	if err != nil {
-		log.Printf("Failed to validate JWT: %v", err)
-		respondWithError(writer, http.StatusUnauthorized, "Invalid token")
+	caller, ok := requireScope(writer, request, auth.ScopeChirpsWrite)
+	if !ok {
 		return
 	}
+	requestUserUUID := caller.UserID
 
 	id := request.PathValue("id")
 	if id == "" {
@@ -290,8 +307,9 @@ func (config *APIConfig) DeleteOneChirp(writer http.ResponseWriter, request *htt
 		return
 	}
 
-	// Check if the user making the request is the owner of the chirp
-	if userRequestOwner.ID != userChirpOwner.ID {
+	// Check if the user making the request is the owner of the chirp, or a
+	// moderator removing someone else's
+	if userRequestOwner.ID != userChirpOwner.ID && !caller.HasPermission(auth.PermissionDeleteAnyChirp) {
 		log.Printf("User %v is not authorized to delete chirp %v", userRequestOwner.ID, chirpToDeleteID)
 		respondWithError(writer, http.StatusForbidden, "You are not authorized to delete this chirp")
 		return
@@ -316,6 +334,18 @@ func (config *APIConfig) DeleteOneChirp(writer http.ResponseWriter, request *htt
 	// 	respondWithError(writer, http.StatusForbidden, "You are not authorized to delete this chirp")
 	// 	return
 	// }
+	if userRequestOwner.ID != userChirpOwner.ID {
+		err = config.removeChirp(requestUserUUID, chirp)
+		if err != nil {
+			log.Printf("Failed to remove chirp: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to delete chirp.")
+			return
+		}
+		log.Printf("Chirp %v of user %v removed by moderator %v", chirpToDeleteID, userChirpOwner.ID, requestUserUUID)
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	err = config.Queries.DeleteOneChirps(context.Background(), chirpToDeleteID)
 	if err != nil {
 		log.Printf("Failed to delete chirp: %v", err)
@@ -326,3 +356,176 @@ func (config *APIConfig) DeleteOneChirp(writer http.ResponseWriter, request *htt
 	writer.WriteHeader(http.StatusNoContent) // No content response
 
 }
+
+// removeChirp deletes someone else's chirp on behalf of a moderator. Like the
+// delete_chirp action of the moderation queue, it resolves the open reports of
+// the chirp and records the action, in the same transaction as the delete.
+func (config *APIConfig) removeChirp(moderatorID uuid.UUID, dbChirp database.Chirp) error {
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	err = recordModeration(queries, database.CreateModerationActionParams{
+		ModeratorID:  uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:       moderationDeleteChirp,
+		ChirpID:      uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: dbChirp.UserID, Valid: true},
+	}, reportActioned)
+	if err != nil {
+		return err
+	}
+	err = queries.DeleteOneChirps(context.Background(), dbChirp.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// canSeeChirp reports whether the caller may see a chirp. Hidden chirps are
+// only shown to their author and to moderators.
+func canSeeChirp(request *http.Request, dbChirp database.Chirp) bool {
+	if !dbChirp.HiddenAt.Valid {
+		return true
+	}
+	principal, ok := PrincipalFromContext(request.Context())
+	return ok && (principal.UserID == dbChirp.UserID || principal.HasPermission(auth.PermissionReviewContent))
+}
+
+// getVisibleChirp loads a chirp the requester may see. Hidden chirps are
+// reported as missing, so that their IDs cannot be probed.
+func (config *APIConfig) getVisibleChirp(request *http.Request, chirpID uuid.UUID) (database.Chirp, error) {
+	dbChirp, err := config.Queries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if !canSeeChirp(request, dbChirp) {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return dbChirp, nil
+}
+
+// getVisibleOriginal is getVisibleChirp for chirps that are quoted or
+// rechirped: for a rechirp it returns the chirp that was rechirped, which has
+// to be visible too.
+func (config *APIConfig) getVisibleOriginal(request *http.Request, chirpID uuid.UUID) (database.Chirp, error) {
+	dbChirp, err := config.getVisibleChirp(request, chirpID)
+	if err != nil || !dbChirp.RechirpOf.Valid {
+		return dbChirp, err
+	}
+	return config.getVisibleChirp(request, dbChirp.RechirpOf.UUID)
+}
+
+// chirpsFromDatabase converts database rows into API chirps and fills in the
+// per-chirp counters that are not stored on the row itself. When viewer is
+// set, LikedByMe is filled in for that user.
+func (config *APIConfig) chirpsFromDatabase(dbChirps []database.Chirp, viewer uuid.NullUUID) ([]Chirp, error) {
+	chirps := make([]Chirp, 0, len(dbChirps))
+	ids := make([]uuid.UUID, 0, len(dbChirps))
+	for _, dbChirp := range dbChirps {
+		chirps = append(chirps, chirpFromDatabase(dbChirp))
+		ids = append(ids, dbChirp.ID)
+	}
+	if len(ids) == 0 {
+		return chirps, nil
+	}
+
+	replyCounts, err := config.Queries.CountRepliesForChirps(context.Background(), ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+	counts := make(map[uuid.UUID]int64, len(replyCounts))
+	for _, row := range replyCounts {
+		counts[row.ChirpID] = row.ReplyCount
+	}
+	for i := range chirps {
+		chirps[i].ReplyCount = counts[chirps[i].ID]
+	}
+
+	likeCounts, err := config.Queries.CountLikesForChirps(context.Background(), ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count likes: %w", err)
+	}
+	likes := make(map[uuid.UUID]int64, len(likeCounts))
+	for _, row := range likeCounts {
+		likes[row.ChirpID] = row.LikeCount
+	}
+	for i := range chirps {
+		chirps[i].LikeCount = likes[chirps[i].ID]
+	}
+
+	err = config.embedOriginals(chirps)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.attachEntities(chirps, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if viewer.Valid {
+		likedIDs, err := config.Queries.ListLikedChirpIDs(context.Background(), database.ListLikedChirpIDsParams{
+			UserID:   viewer.UUID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load likes of viewer: %w", err)
+		}
+		liked := make(map[uuid.UUID]bool, len(likedIDs))
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+		for i := range chirps {
+			likedByMe := liked[chirps[i].ID]
+			chirps[i].LikedByMe = &likedByMe
+		}
+	}
+	return chirps, nil
+}
+
+// embedOriginals attaches the rechirped or quoted chirp to every chirp that
+// references one. Originals that no longer exist become tombstones.
+func (config *APIConfig) embedOriginals(chirps []Chirp) error {
+	var originalIDs []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			originalIDs = append(originalIDs, *chirp.RechirpOf)
+		}
+		if chirp.QuoteOf != nil {
+			originalIDs = append(originalIDs, *chirp.QuoteOf)
+		}
+	}
+	if len(originalIDs) == 0 {
+		return nil
+	}
+
+	dbOriginals, err := config.Queries.GetChirpsByIDs(context.Background(), originalIDs)
+	if err != nil {
+		return fmt.Errorf("failed to load original chirps: %w", err)
+	}
+	originals := make(map[uuid.UUID]database.Chirp, len(dbOriginals))
+	for _, dbOriginal := range dbOriginals {
+		originals[dbOriginal.ID] = dbOriginal
+	}
+
+	for i := range chirps {
+		originalID := chirps[i].RechirpOf
+		if originalID == nil {
+			originalID = chirps[i].QuoteOf
+		}
+		if originalID == nil {
+			continue
+		}
+		if original, ok := originals[*originalID]; ok && original.HiddenAt.Valid {
+			chirps[i].Original = &EmbeddedChirp{ID: *originalID, Hidden: true}
+		} else if ok {
+			chirps[i].Original = embeddedChirpFromDatabase(original)
+		} else {
+			chirps[i].Original = &EmbeddedChirp{ID: *originalID, Deleted: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/entities"
+)
+
+// saveChirpEntities parses the hashtags and mentions in a chirp body and
+// replaces whatever was stored for the chirp before. Mentions of emails that
+// do not belong to a user are ignored.
+func saveChirpEntities(queries *database.Queries, dbChirp database.Chirp) error {
+	err := queries.DeleteChirpHashtags(context.Background(), dbChirp.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear hashtags: %w", err)
+	}
+	err = queries.DeleteChirpMentions(context.Background(), dbChirp.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear mentions: %w", err)
+	}
+
+	found := entities.Parse(dbChirp.Body)
+	var emails []string
+	for _, entity := range found {
+		if entity.Type == entities.Mention {
+			emails = append(emails, entity.Value)
+		}
+	}
+	userIDs := make(map[string]uuid.UUID)
+	if len(emails) > 0 {
+		users, err := queries.GetUsersByEmails(context.Background(), emails)
+		if err != nil {
+			return fmt.Errorf("failed to resolve mentions: %w", err)
+		}
+		for _, user := range users {
+			userIDs[user.Email] = user.ID
+		}
+	}
+
+	for _, entity := range found {
+		switch entity.Type {
+		case entities.Hashtag:
+			err = queries.CreateChirpHashtag(context.Background(), database.CreateChirpHashtagParams{
+				ChirpID:     dbChirp.ID,
+				Tag:         entities.NormalizeTag(entity.Value),
+				StartOffset: int32(entity.Start),
+				EndOffset:   int32(entity.End),
+			})
+		case entities.Mention:
+			userID, ok := userIDs[entity.Value]
+			if !ok {
+				continue
+			}
+			err = queries.CreateChirpMention(context.Background(), database.CreateChirpMentionParams{
+				ChirpID:     dbChirp.ID,
+				UserID:      userID,
+				StartOffset: int32(entity.Start),
+				EndOffset:   int32(entity.End),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save %s: %w", entity.Type, err)
+		}
+	}
+	return nil
+}
+
+// attachEntities loads the stored hashtags and mentions of the given chirps.
+func (config *APIConfig) attachEntities(chirps []Chirp, ids []uuid.UUID) error {
+	hashtags, err := config.Queries.ListHashtagsForChirps(context.Background(), ids)
+	if err != nil {
+		return fmt.Errorf("failed to load hashtags: %w", err)
+	}
+	mentions, err := config.Queries.ListMentionsForChirps(context.Background(), ids)
+	if err != nil {
+		return fmt.Errorf("failed to load mentions: %w", err)
+	}
+
+	byChirp := make(map[uuid.UUID]*Chirp, len(chirps))
+	for i := range chirps {
+		byChirp[chirps[i].ID] = &chirps[i]
+	}
+	for _, hashtag := range hashtags {
+		chirp := byChirp[hashtag.ChirpID]
+		chirp.Entities = append(chirp.Entities, entityFromBody(chirp.Body, string(entities.Hashtag), hashtag.StartOffset, hashtag.EndOffset))
+	}
+	for _, mention := range mentions {
+		chirp := byChirp[mention.ChirpID]
+		entity := entityFromBody(chirp.Body, string(entities.Mention), mention.StartOffset, mention.EndOffset)
+		userID := mention.UserID
+		entity.UserID = &userID
+		chirp.Entities = append(chirp.Entities, entity)
+	}
+	// Hashtags and mentions were appended separately; put them back in
+	// reading order.
+	for i := range chirps {
+		list := chirps[i].Entities
+		sort.Slice(list, func(a, b int) bool { return list[a].Start < list[b].Start })
+	}
+	return nil
+}
+
+func entityFromBody(body, entityType string, start, end int32) Entity {
+	entity := Entity{Type: entityType, Start: int(start), End: int(end)}
+	runes := []rune(body)
+	if entity.Start < entity.End && entity.End <= len(runes) {
+		entity.Text = string(runes[entity.Start+1 : entity.End])
+	}
+	return entity
+}
+
+// GetHashtagChirps lists the chirps using a hashtag, newest first, paginated
+// with "limit" and "cursor".
+func (config *APIConfig) GetHashtagChirps(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Hashtag chirps must be a GET request")
+		return
+	}
+
+	tag := entities.NormalizeTag(request.PathValue("tag"))
+	if tag == "" {
+		respondWithError(writer, http.StatusBadRequest, "Hashtag required")
+		return
+	}
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpsByHashtagParams{
+		Tag:   tag,
+		Limit: int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbChirps, err := config.Queries.ListChirpsByHashtag(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to get chirps by hashtag: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get chirps")
+		return
+	}
+	if len(dbChirps) > limit {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[len(dbChirps)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	chirps, err := config.chirpsFromDatabase(dbChirps, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get chirps")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, chirps)
+}
+
+// GetUserMentions lists the chirps mentioning the user in the path, newest
+// first, paginated with "limit" and "cursor".
+func (config *APIConfig) GetUserMentions(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Mentions must be a GET request")
+		return
+	}
+
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpsMentioningUserParams{
+		UserID: userID,
+		Limit:  int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbChirps, err := config.Queries.ListChirpsMentioningUser(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to get chirps mentioning user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get mentions")
+		return
+	}
+	if len(dbChirps) > limit {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[len(dbChirps)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	chirps, err := config.chirpsFromDatabase(dbChirps, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get mentions")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, chirps)
+}
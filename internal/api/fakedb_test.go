@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// fakeUsers answers the account check of the auth middleware, which looks up
+// the suspension of the user a token was issued to. Users missing from the
+// map do not exist; a nil time means the account is active.
+type fakeUsers map[uuid.UUID]*time.Time
+
+// queries returns database queries backed by users. Any query other than the
+// suspension lookup fails.
+func (users fakeUsers) queries(t *testing.T) *database.Queries {
+	t.Helper()
+	db := sql.OpenDB(users)
+	t.Cleanup(func() { db.Close() })
+	return database.New(db)
+}
+
+func (users fakeUsers) Connect(context.Context) (driver.Conn, error) { return fakeConn{users}, nil }
+func (users fakeUsers) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ users fakeUsers }
+
+func (conn fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt(conn), nil }
+func (conn fakeConn) Close() error                              { return nil }
+func (conn fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake database does not support transactions")
+}
+
+type fakeStmt struct{ users fakeUsers }
+
+func (stmt fakeStmt) Close() error  { return nil }
+func (stmt fakeStmt) NumInput() int { return 1 }
+func (stmt fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("fake database is read-only")
+}
+
+func (stmt fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	id, err := uuid.Parse(args[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	suspendedAt, ok := stmt.users[id]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	var value driver.Value
+	if suspendedAt != nil {
+		value = *suspendedAt
+	}
+	return &fakeRows{values: []driver.Value{value}}, nil
+}
+
+// fakeRows holds at most one row of a single column.
+type fakeRows struct{ values []driver.Value }
+
+func (rows *fakeRows) Columns() []string { return []string{"suspended_at"} }
+func (rows *fakeRows) Close() error      { return nil }
+func (rows *fakeRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+	dest[0], rows.values = rows.values[0], rows.values[1:]
+	return nil
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/filter"
+)
+
+// ReloadContentFilter rebuilds the active content filter from the rules
+// loaded from file and the rules stored in the database. Database rules win
+// when both define the same word.
+func (config *APIConfig) ReloadContentFilter() error {
+	dbRules, err := config.Queries.ListFilterRules(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to load filter rules: %w", err)
+	}
+
+	rules := make([]filter.Rule, 0, len(config.FilterFileRules)+len(dbRules))
+	rules = append(rules, config.FilterFileRules...)
+	for _, dbRule := range dbRules {
+		action, err := filter.ParseAction(dbRule.Action)
+		if err != nil {
+			return fmt.Errorf("invalid filter rule %q: %w", dbRule.Word, err)
+		}
+		rules = append(rules, filter.Rule{Word: dbRule.Word, Action: action})
+	}
+	config.ContentFilter.Replace(rules)
+	return nil
+}
+
+// flagChirp records that the content filter flagged a chirp for review.
+// Failing to record the flag does not fail the request that wrote the chirp.
+func (config *APIConfig) flagChirp(chirpID uuid.UUID, checked filter.Result) {
+	var words []string
+	for _, match := range checked.Matches {
+		if match.Action == filter.Flag {
+			words = append(words, match.Word)
+		}
+	}
+	err := config.Queries.UpsertChirpFlag(context.Background(), database.UpsertChirpFlagParams{
+		ChirpID: chirpID,
+		Reason:  "matched flagged words: " + strings.Join(words, ", "),
+	})
+	if err != nil {
+		log.Printf("Failed to flag chirp %v: %v", chirpID, err)
+	}
+}
+
+// ListFilterRules lists every active content filter rule, from the database
+// and from the rules file.
+func (config *APIConfig) ListFilterRules(writer http.ResponseWriter, request *http.Request) {
+	dbRules, err := config.Queries.ListFilterRules(context.Background())
+	if err != nil {
+		log.Printf("Failed to list filter rules: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list filter rules")
+		return
+	}
+
+	rules := make([]FilterRule, 0, len(dbRules)+len(config.FilterFileRules))
+	for _, dbRule := range dbRules {
+		id := dbRule.ID
+		rules = append(rules, FilterRule{ID: &id, Word: dbRule.Word, Action: dbRule.Action, Source: "database"})
+	}
+	for _, fileRule := range config.FilterFileRules {
+		rules = append(rules, FilterRule{Word: filter.Normalize(fileRule.Word), Action: string(fileRule.Action), Source: "file"})
+	}
+	respondWithJSON(writer, http.StatusOK, rules)
+}
+
+// CreateFilterRule adds a content filter rule, or changes the action of the
+// existing rule for the same word. It takes effect immediately.
+func (config *APIConfig) CreateFilterRule(writer http.ResponseWriter, request *http.Request) {
+	type FilterRuleRequest struct {
+		Word   string `json:"word"`
+		Action string `json:"action"`
+	}
+
+	var ruleRequest FilterRuleRequest
+	err := json.NewDecoder(request.Body).Decode(&ruleRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	word, err := filter.ParseWord(ruleRequest.Word)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	action, err := filter.ParseAction(ruleRequest.Action)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbRule, err := config.Queries.UpsertFilterRule(context.Background(), database.UpsertFilterRuleParams{
+		Word:   word,
+		Action: string(action),
+	})
+	if err != nil {
+		log.Printf("Failed to save filter rule: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to save filter rule")
+		return
+	}
+	err = config.ReloadContentFilter()
+	if err != nil {
+		log.Printf("Failed to reload content filter: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reload content filter")
+		return
+	}
+
+	log.Printf("Filter rule %q set to %s", dbRule.Word, dbRule.Action)
+	respondWithJSON(writer, http.StatusCreated, FilterRule{
+		ID:     &dbRule.ID,
+		Word:   dbRule.Word,
+		Action: dbRule.Action,
+		Source: "database",
+	})
+}
+
+// DeleteFilterRule removes a content filter rule stored in the database.
+func (config *APIConfig) DeleteFilterRule(writer http.ResponseWriter, request *http.Request) {
+	ruleID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid rule ID format")
+		return
+	}
+
+	deleted, err := config.Queries.DeleteFilterRule(context.Background(), ruleID)
+	if err != nil {
+		log.Printf("Failed to delete filter rule: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to delete filter rule")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(writer, http.StatusNotFound, "Filter rule not found")
+		return
+	}
+	err = config.ReloadContentFilter()
+	if err != nil {
+		log.Printf("Failed to reload content filter: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reload content filter")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ListFlaggedChirps lists the chirps the content filter flagged for review,
+// most recent first, paginated with "limit" and "cursor".
+func (config *APIConfig) ListFlaggedChirps(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpFlagsParams{
+		Limit: int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbFlags, err := config.Queries.ListChirpFlags(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to list flagged chirps: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list flagged chirps")
+		return
+	}
+	if len(dbFlags) > limit {
+		dbFlags = dbFlags[:limit]
+		last := dbFlags[len(dbFlags)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ChirpID}))
+	}
+
+	flags := make([]ChirpFlag, 0, len(dbFlags))
+	for _, dbFlag := range dbFlags {
+		flags = append(flags, ChirpFlag{ChirpID: dbFlag.ChirpID, Reason: dbFlag.Reason, FlaggedAt: dbFlag.CreatedAt})
+	}
+	respondWithJSON(writer, http.StatusOK, flags)
+}
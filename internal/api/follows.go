@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// FollowUser makes the authenticated user follow the user in the path.
+// Following someone twice is a no-op.
+func (config *APIConfig) FollowUser(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Follow must be a POST request")
+		return
+	}
+
+	followerID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	followeeID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	if followeeID == followerID {
+		respondWithError(writer, http.StatusBadRequest, "You cannot follow yourself")
+		return
+	}
+
+	_, err = config.Queries.GetUserById(context.Background(), followeeID)
+	if err != nil {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+
+	err = config.Queries.CreateFollow(context.Background(), database.CreateFollowParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Failed to follow user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to follow user")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// UnfollowUser removes the follow from the authenticated user to the user in
+// the path. Unfollowing someone you do not follow is a no-op.
+func (config *APIConfig) UnfollowUser(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Unfollow must be a DELETE request")
+		return
+	}
+
+	followerID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	followeeID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	err = config.Queries.DeleteFollow(context.Background(), database.DeleteFollowParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Failed to unfollow user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to unfollow user")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetFollowers lists the users following the user in the path, most recent
+// first.
+func (config *APIConfig) GetFollowers(writer http.ResponseWriter, request *http.Request) {
+	config.listFollows(writer, request, func(params database.ListFollowersParams) ([]Follow, error) {
+		rows, err := config.Queries.ListFollowers(context.Background(), params)
+		follows := make([]Follow, 0, len(rows))
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.FollowerID, FollowedAt: row.CreatedAt})
+		}
+		return follows, err
+	})
+}
+
+// GetFollowing lists the users followed by the user in the path, most recent
+// first.
+func (config *APIConfig) GetFollowing(writer http.ResponseWriter, request *http.Request) {
+	config.listFollows(writer, request, func(params database.ListFollowersParams) ([]Follow, error) {
+		rows, err := config.Queries.ListFollowing(context.Background(), database.ListFollowingParams(params))
+		follows := make([]Follow, 0, len(rows))
+		for _, row := range rows {
+			follows = append(follows, Follow{UserID: row.FolloweeID, FollowedAt: row.CreatedAt})
+		}
+		return follows, err
+	})
+}
+
+// listFollows holds the request parsing and pagination shared by the
+// follower and following listings.
+func (config *APIConfig) listFollows(writer http.ResponseWriter, request *http.Request, list func(database.ListFollowersParams) ([]Follow, error)) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Must be a GET request")
+		return
+	}
+
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListFollowersParams{
+		UserID: userID,
+		Limit:  int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	follows, err := list(params)
+	if err != nil {
+		log.Printf("Failed to list follows: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list follows")
+		return
+	}
+	if len(follows) > limit {
+		follows = follows[:limit]
+		last := follows[len(follows)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.FollowedAt, ID: last.UserID}))
+	}
+	respondWithJSON(writer, http.StatusOK, follows)
+}
+
+// GetTimeline returns the chirps of the accounts the authenticated user
+// follows, newest first, paginated with "limit" and "cursor".
+func (config *APIConfig) GetTimeline(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Timeline must be a GET request")
+		return
+	}
+
+	caller, ok := requireScope(writer, request, auth.ScopeChirpsRead)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListTimelineChirpsParams{
+		UserID: userID,
+		Limit:  int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbChirps, err := config.Queries.ListTimelineChirps(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to get timeline: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get timeline")
+		return
+	}
+	if len(dbChirps) > limit {
+		dbChirps = dbChirps[:limit]
+		last := dbChirps[len(dbChirps)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	chirps, err := config.chirpsFromDatabase(dbChirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get timeline")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, chirps)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// LikeChirp records a like from the authenticated user on the chirp in the
+// path. Liking a chirp twice is a no-op.
+func (config *APIConfig) LikeChirp(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Like must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	_, err = config.getVisibleChirp(request, chirpID)
+	if err != nil {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	err = config.Queries.CreateChirpLike(context.Background(), database.CreateChirpLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Failed to like chirp: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to like chirp")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// UnlikeChirp removes the authenticated user's like from the chirp in the
+// path. Removing a like that does not exist is a no-op.
+func (config *APIConfig) UnlikeChirp(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Unlike must be a DELETE request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	err = config.Queries.DeleteChirpLike(context.Background(), database.DeleteChirpLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Failed to unlike chirp: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to unlike chirp")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetChirpLikes lists the users who liked the chirp in the path, most recent
+// first, paginated with "limit" and "cursor".
+func (config *APIConfig) GetChirpLikes(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Likes must be a GET request")
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpLikesParams{
+		ChirpID: chirpID,
+		Limit:   int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbChirp, err := config.Queries.GetChirpByID(context.Background(), chirpID)
+	if err != nil || !canSeeChirp(request, dbChirp) {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	dbLikes, err := config.Queries.ListChirpLikes(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to list chirp likes: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list likes")
+		return
+	}
+	if len(dbLikes) > limit {
+		dbLikes = dbLikes[:limit]
+		last := dbLikes[len(dbLikes)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.UserID}))
+	}
+
+	likes := make([]Like, 0, len(dbLikes))
+	for _, dbLike := range dbLikes {
+		likes = append(likes, Like{UserID: dbLike.UserID, LikedAt: dbLike.CreatedAt})
+	}
+	respondWithJSON(writer, http.StatusOK, likes)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// Outcomes of login attempts, as recorded in the login_attempts table.
+const (
+	loginSucceeded         = "success"
+	loginTwoFactorRequired = "two_factor_required"
+	loginUnknownEmail      = "unknown_email"
+	loginWrongPassword     = "wrong_password"
+	loginWrongCode         = "wrong_code"
+	loginThrottled         = "throttled"
+	loginSuspended         = "suspended"
+)
+
+// recordLoginAttempt adds an attempt to the audit log. Failing to record it
+// does not fail the login.
+func (config *APIConfig) recordLoginAttempt(request *http.Request, email string, userID uuid.NullUUID, outcome string) {
+	err := config.Queries.CreateLoginAttempt(context.Background(), database.CreateLoginAttemptParams{
+		Email:     email,
+		UserID:    userID,
+		IpAddress: config.ClientIP(request),
+		UserAgent: request.UserAgent(),
+		Outcome:   outcome,
+	})
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+// checkLoginThrottle makes sure the client may try to log in to the account
+// now. When it returns false a 429 or 500 response has already been written.
+func (config *APIConfig) checkLoginThrottle(writer http.ResponseWriter, request *http.Request, email string, userID uuid.NullUUID) bool {
+	wait, err := config.LoginLimiter.Check(context.Background(), email, config.ClientIP(request))
+	if err != nil {
+		log.Printf("Failed to check login throttle: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to log in")
+		return false
+	}
+	if wait > 0 {
+		config.recordLoginAttempt(request, email, userID, loginThrottled)
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondWithError(writer, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return false
+	}
+	return true
+}
+
+// failLogin counts a failed attempt against the account and the client and
+// responds with 401.
+func (config *APIConfig) failLogin(writer http.ResponseWriter, request *http.Request, email string, userID uuid.NullUUID, outcome, message string) {
+	config.recordLoginAttempt(request, email, userID, outcome)
+	_, err := config.LoginLimiter.Fail(context.Background(), email, config.ClientIP(request))
+	if err != nil {
+		log.Printf("Failed to count failed login: %v", err)
+	}
+	respondWithError(writer, http.StatusUnauthorized, message)
+}
+
+// succeedLogin clears the failures of the account once the user is fully
+// signed in.
+func (config *APIConfig) succeedLogin(request *http.Request, dbUser database.User) {
+	config.recordLoginAttempt(request, dbUser.Email, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, loginSucceeded)
+	err := config.LoginLimiter.Succeed(context.Background(), dbUser.Email)
+	if err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+}
+
+// rejectSuspendedLogin answers a login to a suspended account with a 403 and
+// records the attempt. It returns false when the account is not suspended.
+// It is only called once the credentials have been checked, so that the
+// suspension is not revealed to someone guessing passwords.
+func (config *APIConfig) rejectSuspendedLogin(writer http.ResponseWriter, request *http.Request, dbUser database.User) bool {
+	if !dbUser.SuspendedAt.Valid {
+		return false
+	}
+	config.recordLoginAttempt(request, dbUser.Email, uuid.NullUUID{UUID: dbUser.ID, Valid: true}, loginSuspended)
+	respondWithError(writer, http.StatusForbidden, "Account is suspended")
+	return true
+}
+
+// UnlockUser lifts the login backoff or lockout of an account.
+func (config *APIConfig) UnlockUser(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Unlock must be a POST request")
+		return
+	}
+
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+
+	err = config.LoginLimiter.Unlock(context.Background(), dbUser.Email)
+	if err != nil {
+		log.Printf("Failed to unlock user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to unlock user")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
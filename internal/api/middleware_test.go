@@ -0,0 +1,228 @@
+package api_test
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/api"
+	"github.com/jrmts/Chrispy/internal/auth"
+)
+
+func newKeySet(t *testing.T) *auth.KeySet {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet, err := auth.NewKeySet("chirpy", "chirpy", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keySet
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	keySet := newKeySet(t)
+	userID := uuid.New()
+	suspendedUserID := uuid.New()
+	suspendedAt := time.Now()
+	config := &api.APIConfig{
+		JWTKeys: keySet,
+		Queries: fakeUsers{userID: nil, suspendedUserID: &suspendedAt}.queries(t),
+	}
+	validToken, _ := keySet.MakeJWT(userID, nil, time.Hour)
+	expiredToken, _ := keySet.MakeJWT(userID, nil, -time.Hour)
+	foreignToken, _ := newKeySet(t).MakeJWT(userID, nil, time.Hour)
+	suspendedToken, _ := keySet.MakeJWT(suspendedUserID, nil, time.Hour)
+	deletedUserToken, _ := keySet.MakeJWT(uuid.New(), nil, time.Hour)
+
+	const unauthorizedBody = "{\"error\":\"Invalid or missing token\"}\n"
+	tests := []struct {
+		name          string
+		middleware    func(http.Handler) http.Handler
+		authorization string
+		wantStatus    int
+		wantChallenge string
+		wantUserID    uuid.UUID
+	}{
+		{
+			name:          "Required, no token",
+			middleware:    config.RequireAuth,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy"`,
+		},
+		{
+			name:          "Required, not a bearer token",
+			middleware:    config.RequireAuth,
+			authorization: "ApiKey abc",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token"`,
+		},
+		{
+			name:          "Required, garbage token",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer not-a-jwt",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token"`,
+		},
+		{
+			name:          "Required, expired token",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer " + expiredToken,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token"`,
+		},
+		{
+			name:          "Required, token signed by another key",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer " + foreignToken,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token"`,
+		},
+		{
+			name:          "Required, valid token",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+			wantUserID:    userID,
+		},
+		{
+			name:          "Required, suspended user",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer " + suspendedToken,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "Required, deleted user",
+			middleware:    config.RequireAuth,
+			authorization: "Bearer " + deletedUserToken,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="chirpy", error="invalid_token"`,
+		},
+		{
+			name:       "Optional, no token",
+			middleware: config.OptionalAuth,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "Optional, expired token",
+			middleware:    config.OptionalAuth,
+			authorization: "Bearer " + expiredToken,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Optional, suspended user",
+			middleware:    config.OptionalAuth,
+			authorization: "Bearer " + suspendedToken,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "Optional, valid token",
+			middleware:    config.OptionalAuth,
+			authorization: "Bearer " + validToken,
+			wantStatus:    http.StatusOK,
+			wantUserID:    userID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID uuid.UUID
+			handler := tt.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if principal, ok := api.PrincipalFromContext(request.Context()); ok {
+					gotUserID = principal.UserID
+					if principal.PersonalAccessToken {
+						t.Error("principal of a JWT marked as a personal access token")
+					}
+				}
+				writer.WriteHeader(http.StatusOK)
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if got := recorder.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && recorder.Body.String() != unauthorizedBody {
+				t.Errorf("body = %q, want %q", recorder.Body.String(), unauthorizedBody)
+			}
+			if gotUserID != tt.wantUserID {
+				t.Errorf("principal user = %v, want %v", gotUserID, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestPrincipalHasScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal api.Principal
+		scope     auth.Scope
+		want      bool
+	}{
+		{name: "Login", principal: api.Principal{}, scope: auth.ScopeProfileWrite, want: true},
+		{name: "Granted", principal: api.Principal{PersonalAccessToken: true, Scopes: []string{"chirps:read"}}, scope: auth.ScopeChirpsRead, want: true},
+		{name: "Not granted", principal: api.Principal{PersonalAccessToken: true, Scopes: []string{"chirps:read"}}, scope: auth.ScopeChirpsWrite, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%s) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	keySet := newKeySet(t)
+	userID := uuid.New()
+	config := &api.APIConfig{JWTKeys: keySet, Queries: fakeUsers{userID: nil}.queries(t)}
+	userToken, _ := keySet.MakeJWT(userID, []string{"user"}, time.Hour)
+	moderatorToken, _ := keySet.MakeJWT(userID, []string{"user", "moderator"}, time.Hour)
+	adminToken, _ := keySet.MakeJWT(userID, []string{"user", "admin"}, time.Hour)
+
+	tests := []struct {
+		name          string
+		permission    auth.Permission
+		authorization string
+		wantStatus    int
+	}{
+		{name: "No token", permission: auth.PermissionViewMetrics, wantStatus: http.StatusUnauthorized},
+		{name: "User", permission: auth.PermissionViewMetrics, authorization: "Bearer " + userToken, wantStatus: http.StatusForbidden},
+		{name: "Moderator reviewing content", permission: auth.PermissionReviewContent, authorization: "Bearer " + moderatorToken, wantStatus: http.StatusOK},
+		{name: "Moderator managing users", permission: auth.PermissionManageUsers, authorization: "Bearer " + moderatorToken, wantStatus: http.StatusForbidden},
+		{name: "Admin", permission: auth.PermissionManageUsers, authorization: "Bearer " + adminToken, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := config.RequireAuth(config.RequirePermission(tt.permission, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusOK)
+			})))
+
+			request := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
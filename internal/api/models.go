@@ -1,19 +1,56 @@
 package api
 
 import (
+	"database/sql"
+	"net/netip"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
 	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/filter"
+	"github.com/jrmts/Chrispy/internal/lockout"
+	"github.com/jrmts/Chrispy/internal/mail"
 )
 
 type APIConfig struct {
 	FileserverHits atomic.Int32
+	DB             *sql.DB
 	Queries        *database.Queries
 	Platform       string
-	SecretKey      string
-	PolkaKey       string
+	// SecretKey signs the short-lived challenge tokens of two-factor logins.
+	SecretKey string
+	// JWTKeys signs and verifies access tokens.
+	JWTKeys  *auth.KeySet
+	PolkaKey string
+	// TOTPKey encrypts the two-factor secrets stored in the database. When it
+	// is empty users cannot enroll in two-factor authentication.
+	TOTPKey []byte
+	// LoginLimiter throttles failed logins. When it is nil logins are not
+	// throttled.
+	LoginLimiter *lockout.Limiter
+	// Mailer sends password reset and email verification emails.
+	Mailer mail.Mailer
+	// PasswordHasher hashes new passwords and checks stored hashes.
+	PasswordHasher auth.PasswordHasher
+	// PasswordPolicy decides which passwords users may choose.
+	PasswordPolicy auth.PasswordPolicy
+	// RequireVerifiedEmail stops users from posting chirps until they have
+	// verified their email address.
+	RequireVerifiedEmail bool
+	// ReportHideThreshold is the number of users whose open reports hide a
+	// chirp until a moderator reviews it. Zero never hides chirps
+	// automatically.
+	ReportHideThreshold int
+	ContentFilter       *filter.Filter
+	// TrustedProxies are the addresses of the load balancers or reverse
+	// proxies in front of the server. X-Forwarded-For is only believed when
+	// it comes from one of them.
+	TrustedProxies []netip.Prefix
+	// FilterFileRules are the content filter rules loaded from a word list at
+	// startup. They are combined with the rules stored in the database.
+	FilterFileRules []filter.Rule
 }
 
 type User struct {
@@ -27,12 +64,228 @@ type User struct {
 	Token        string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	// EmailVerified is true once the user followed the link in the
+	// verification email.
+	EmailVerified bool `json:"email_verified"`
+	// Roles is only set in login responses, and always includes "user".
+	Roles []string `json:"roles,omitempty"`
+	// DeviceLabel names the session started by a login, e.g. "Jane's phone".
+	DeviceLabel string `json:"device_label,omitempty"`
+}
+
+// AdminUser is a user as shown to admins.
+type AdminUser struct {
+	ID               uuid.UUID  `json:"id"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	Email            string     `json:"email"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	// Roles is only set when a single user is requested.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Report is a user's report of a chirp. The moderation queue also fills in
+// Chirp and OpenReportCount, the number of open reports of the chirp.
+type Report struct {
+	ID uuid.UUID `json:"id"`
+	// ChirpID is null once the reported chirp has been deleted.
+	ChirpID         *uuid.UUID     `json:"chirp_id"`
+	ReporterID      uuid.UUID      `json:"reporter_id"`
+	Reason          string         `json:"reason"`
+	Details         string         `json:"details,omitempty"`
+	Status          string         `json:"status"`
+	CreatedAt       time.Time      `json:"created_at"`
+	ResolvedAt      *time.Time     `json:"resolved_at,omitempty"`
+	ResolvedBy      *uuid.UUID     `json:"resolved_by,omitempty"`
+	Chirp           *ReportedChirp `json:"chirp,omitempty"`
+	OpenReportCount int64          `json:"open_report_count,omitempty"`
+}
+
+// ReportedChirp is the chirp a report is about, as shown in the moderation
+// queue.
+type ReportedChirp struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	Body     string     `json:"body"`
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+}
+
+// UserRoles lists the roles of a user.
+type UserRoles struct {
+	UserID uuid.UUID `json:"user_id"`
+	Roles  []string  `json:"roles"`
+}
+
+// PasswordPolicyError is the 422 response to a password that breaks the
+// password policy.
+type PasswordPolicyError struct {
+	Error      string                   `json:"error"`
+	Violations []auth.PasswordViolation `json:"violations"`
+}
+
+// PersonalAccessToken is an API token a user created for a bot or an
+// integration. Token is only set in the response that creates it.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// TwoFactorSetup is returned when a user starts enrolling an authenticator.
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorChallenge is returned by a login with the right password when the
+// user has two-factor authentication enabled.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// Session is a signed-in device: a chain of rotated refresh tokens. LastUsedAt
+// is the last time the device refreshed its access token.
+type Session struct {
+	ID          uuid.UUID `json:"id"`
+	DeviceLabel string    `json:"device_label"`
+	UserAgent   string    `json:"user_agent"`
+	IPAddress   string    `json:"ip_address"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Body      string    `json:"body"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to,omitempty"`
+	ReplyCount int64      `json:"reply_count"`
+	LikeCount  int64      `json:"like_count"`
+	// LikedByMe is only set when the request was made by a signed-in user.
+	LikedByMe *bool      `json:"liked_by_me,omitempty"`
+	RechirpOf *uuid.UUID `json:"rechirp_of,omitempty"`
+	QuoteOf   *uuid.UUID `json:"quote_of,omitempty"`
+	// Original is the rechirped or quoted chirp, embedded for display.
+	Original *EmbeddedChirp `json:"original,omitempty"`
+	Entities []Entity       `json:"entities"`
+	// HiddenAt is set when moderation hid the chirp. Hidden chirps are only
+	// shown to their author and to moderators.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+}
+
+// Entity is a hashtag or mention in a chirp body. Start and End are code point
+// offsets into the body, sigil included; Text is the entity without it.
+type Entity struct {
+	Type   string     `json:"type"`
+	Text   string     `json:"text"`
+	Start  int        `json:"start"`
+	End    int        `json:"end"`
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+}
+
+// EmbeddedChirp is a rechirped or quoted chirp shown inside another chirp.
+// When the original has been deleted only its ID and Deleted are set.
+type EmbeddedChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Body      string     `json:"body,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	// Hidden is true when moderation hid the original; its content is left
+	// out.
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// ChirpThread is a chirp together with the chain of chirps it replies to
+// (root first) and a page of the replies below it.
+type ChirpThread struct {
+	Ancestors []Chirp `json:"ancestors"`
+	Chirp     Chirp   `json:"chirp"`
+	Replies   []Chirp `json:"replies"`
+}
+
+// ChirpRevision is a previous version of an edited chirp. CreatedAt is when
+// the version was written and ReplacedAt when an edit superseded it.
+type ChirpRevision struct {
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// FilterRule is a content filter rule as shown to admins. Rules loaded from a
+// file have no ID and cannot be changed through the API.
+type FilterRule struct {
+	ID     *uuid.UUID `json:"id,omitempty"`
+	Word   string     `json:"word"`
+	Action string     `json:"action"`
+	Source string     `json:"source"`
+}
+
+// ChirpFlag is a chirp the content filter marked for review.
+type ChirpFlag struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Reason    string    `json:"reason"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// Follow is one entry of a follower or following list.
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// Like is one entry of the list of users who liked a chirp.
+type Like struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// chirpFromDatabase converts a database row into the API representation.
+func chirpFromDatabase(dbChirp database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        dbChirp.ID,
+		UserID:    dbChirp.UserID,
+		Body:      dbChirp.Body,
+		CreatedAt: dbChirp.CreatedAt,
+		UpdatedAt: dbChirp.UpdatedAt,
+		Entities:  []Entity{},
+	}
+	if dbChirp.InReplyTo.Valid {
+		inReplyTo := dbChirp.InReplyTo.UUID
+		chirp.InReplyTo = &inReplyTo
+	}
+	if dbChirp.RechirpOf.Valid {
+		rechirpOf := dbChirp.RechirpOf.UUID
+		chirp.RechirpOf = &rechirpOf
+	}
+	if dbChirp.QuoteOf.Valid {
+		quoteOf := dbChirp.QuoteOf.UUID
+		chirp.QuoteOf = &quoteOf
+	}
+	if dbChirp.HiddenAt.Valid {
+		hiddenAt := dbChirp.HiddenAt.Time
+		chirp.HiddenAt = &hiddenAt
+	}
+	return chirp
+}
+
+// embeddedChirpFromDatabase converts the original of a rechirp or quote.
+func embeddedChirpFromDatabase(dbChirp database.Chirp) *EmbeddedChirp {
+	return &EmbeddedChirp{
+		ID:        dbChirp.ID,
+		UserID:    &dbChirp.UserID,
+		Body:      dbChirp.Body,
+		CreatedAt: &dbChirp.CreatedAt,
+	}
 }
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor points at the last item of a page. The next page starts right
+// after it in the (created_at, id) ordering.
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// encodeCursor turns a cursor into the opaque string handed out to clients.
+func encodeCursor(cursor pageCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.raw()))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor.
+func decodeCursor(encoded string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	return parsePageCursor(string(raw))
+}
+
+func (cursor pageCursor) raw() string {
+	return cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String()
+}
+
+func parsePageCursor(raw string) (pageCursor, error) {
+	createdAt, id, found := strings.Cut(raw, "|")
+	if !found {
+		return pageCursor{}, fmt.Errorf("invalid cursor format")
+	}
+	cursor := pageCursor{}
+	var err error
+	cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+	cursor.ID, err = uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor id: %w", err)
+	}
+	return cursor, nil
+}
+
+// rankedCursor is the cursor used by relevance-ordered listings such as
+// search, where items are ordered by (rank, created_at, id).
+type rankedCursor struct {
+	Rank float32
+	pageCursor
+}
+
+// encodeRankedCursor turns a ranked cursor into an opaque string.
+func encodeRankedCursor(cursor rankedCursor) string {
+	rank := strconv.FormatFloat(float64(cursor.Rank), 'g', -1, 32)
+	return base64.RawURLEncoding.EncodeToString([]byte(rank + "|" + cursor.pageCursor.raw()))
+}
+
+// decodeRankedCursor parses a cursor produced by encodeRankedCursor.
+func decodeRankedCursor(encoded string) (rankedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return rankedCursor{}, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	rank, rest, found := strings.Cut(string(raw), "|")
+	if !found {
+		return rankedCursor{}, fmt.Errorf("invalid cursor format")
+	}
+	parsedRank, err := strconv.ParseFloat(rank, 32)
+	if err != nil {
+		return rankedCursor{}, fmt.Errorf("invalid cursor rank: %w", err)
+	}
+	cursor, err := parsePageCursor(rest)
+	if err != nil {
+		return rankedCursor{}, err
+	}
+	return rankedCursor{Rank: float32(parsedRank), pageCursor: cursor}, nil
+}
+
+// parseLimit reads the "limit" query parameter, falling back to the default
+// page size when it is absent.
+func parseLimit(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
+// parseCursor reads the optional "cursor" query parameter and returns the
+// position to continue after, in the shape the list queries expect.
+func parseCursor(query url.Values) (sql.NullTime, uuid.NullUUID, error) {
+	encoded := query.Get("cursor")
+	if encoded == "" {
+		return sql.NullTime{}, uuid.NullUUID{}, nil
+	}
+	cursor, err := decodeCursor(encoded)
+	if err != nil {
+		return sql.NullTime{}, uuid.NullUUID{}, err
+	}
+	return sql.NullTime{Time: cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: cursor.ID, Valid: true}, nil
+}
+
+// setNextLink advertises the next page through a Link header. The current
+// request URL is reused with its cursor parameter replaced.
+func setNextLink(writer http.ResponseWriter, request *http.Request, cursor string) {
+	next := *request.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	writer.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
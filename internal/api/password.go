@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/mail"
+)
+
+// ForgotPassword emails a password reset token, valid for an hour, to the
+// account with the given email. It answers the same way whether or not the
+// account exists, so that it cannot be used to find out who has an account.
+// No email is sent while an unused one from the last five minutes is still
+// valid, so that the endpoint cannot be used to flood a mailbox.
+func (config *APIConfig) ForgotPassword(writer http.ResponseWriter, request *http.Request) {
+	type ForgotPasswordRequest struct {
+		Email string `json:"email"`
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Password reset must be a POST request")
+		return
+	}
+
+	var forgotRequest ForgotPasswordRequest
+	err := json.NewDecoder(request.Body).Decode(&forgotRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if forgotRequest.Email == "" {
+		respondWithError(writer, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	dbUser, err := config.Queries.GetUserByEmail(context.Background(), forgotRequest.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		writer.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get user by email: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	// The cooldown and the expiry are computed by the database, whose clock
+	// wrote created_at.
+	recentlySent, err := config.Queries.HasRecentPasswordResetToken(context.Background(), dbUser.ID)
+	if err != nil {
+		log.Printf("Failed to check recent password reset tokens: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if recentlySent {
+		writer.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		log.Printf("Failed to generate password reset token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	err = config.Queries.CreatePasswordResetToken(context.Background(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to save password reset token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	// Sending in the background keeps the response time the same for
+	// unknown emails.
+	go config.sendMail(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"To choose a new password, send this token to POST /api/password/reset within an hour:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password has not changed.\n", token),
+	})
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token can only be used once, and every device of the user is signed out.
+func (config *APIConfig) ResetPassword(writer http.ResponseWriter, request *http.Request) {
+	type ResetPasswordRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Password reset must be a POST request")
+		return
+	}
+
+	var resetRequest ResetPasswordRequest
+	err := json.NewDecoder(request.Body).Decode(&resetRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if resetRequest.Token == "" || resetRequest.Password == "" {
+		respondWithError(writer, http.StatusBadRequest, "Token and password are required")
+		return
+	}
+	if !config.checkPassword(writer, resetRequest.Password) {
+		return
+	}
+
+	hashedPassword, err := config.PasswordHasher.Hash(resetRequest.Password)
+	if err != nil {
+		respondWithHashError(writer, err)
+		return
+	}
+
+	dbUser, err := config.resetPassword(auth.HashToken(resetRequest.Token), hashedPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	// Proving access to the mailbox is enough to lift a login lockout.
+	err = config.LoginLimiter.Unlock(context.Background(), dbUser.Email)
+	if err != nil {
+		log.Printf("Failed to unlock user %v: %v", dbUser.ID, err)
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// checkPassword enforces the password policy on a new password. When it
+// returns false a 422 or 500 response has already been written.
+func (config *APIConfig) checkPassword(writer http.ResponseWriter, password string) bool {
+	violations, err := config.PasswordPolicy.Check(password)
+	if err != nil {
+		log.Printf("Failed to check password policy: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to check password")
+		return false
+	}
+	if len(violations) > 0 {
+		respondWithJSON(writer, http.StatusUnprocessableEntity, PasswordPolicyError{
+			Error:      "Password does not meet the password policy",
+			Violations: violations,
+		})
+		return false
+	}
+	return true
+}
+
+// resetPassword uses up the reset token, sets the password and revokes every
+// refresh token of the user. It returns sql.ErrNoRows when the token is
+// unknown, used or expired.
+func (config *APIConfig) resetPassword(tokenHash, hashedPassword string) (database.User, error) {
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return database.User{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	userID, err := queries.UsePasswordResetToken(context.Background(), tokenHash)
+	if err != nil {
+		return database.User{}, err
+	}
+	dbUser, err := queries.UpdateUserPassword(context.Background(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	err = queries.DeletePasswordResetTokens(context.Background(), userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	err = queries.RevokeAllRefreshTokensForUser(context.Background(), userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	return dbUser, tx.Commit()
+}
+
+// sendMail sends a message with the configured mailer and logs failures.
+func (config *APIConfig) sendMail(message mail.Message) {
+	if config.Mailer == nil {
+		log.Printf("No mailer configured, dropping mail to %s: %s", message.To, message.Subject)
+		return
+	}
+	err := config.Mailer.Send(context.Background(), message)
+	if err != nil {
+		log.Printf("Failed to send mail: %v", err)
+	}
+}
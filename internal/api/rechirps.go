@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// Rechirp re-shares the chirp in the path on behalf of the authenticated
+// user. Rechirping a rechirp re-shares the original chirp, and each user can
+// rechirp a given chirp only once.
+func (config *APIConfig) Rechirp(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Rechirp must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	original, err := config.getVisibleOriginal(request, chirpID)
+	if err != nil {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	originalID := uuid.NullUUID{UUID: original.ID, Valid: true}
+
+	dbChirp, err := config.Queries.CreateRechirp(context.Background(), database.CreateRechirpParams{
+		UserID:    userID,
+		RechirpOf: originalID,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(writer, http.StatusConflict, "You have already rechirped this chirp")
+			return
+		}
+		log.Printf("Failed to rechirp: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to rechirp")
+		return
+	}
+
+	chirps, err := config.chirpsFromDatabase([]database.Chirp{dbChirp}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to load rechirp")
+		return
+	}
+	respondWithJSON(writer, http.StatusCreated, chirps[0])
+}
@@ -0,0 +1,470 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+const maxReportDetailsLength = 1000
+
+// reportReasons are the categories a report can give.
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "misinformation", "other"}
+
+// Statuses of reports.
+const (
+	reportOpen      = "open"
+	reportDismissed = "dismissed"
+	reportActioned  = "actioned"
+)
+
+// Moderation actions, as recorded in the moderation_actions table.
+const (
+	moderationDismiss       = "dismiss"
+	moderationHideChirp     = "hide_chirp"
+	moderationDeleteChirp   = "delete_chirp"
+	moderationSuspendAuthor = "suspend_author"
+	moderationAutoHide      = "auto_hide"
+)
+
+func reportFromDatabase(dbReport database.Report) Report {
+	report := Report{
+		ID:         dbReport.ID,
+		ReporterID: dbReport.ReporterID,
+		Reason:     dbReport.Reason,
+		Details:    dbReport.Details.String,
+		Status:     dbReport.Status,
+		CreatedAt:  dbReport.CreatedAt,
+	}
+	if dbReport.ChirpID.Valid {
+		report.ChirpID = &dbReport.ChirpID.UUID
+	}
+	if dbReport.ResolvedAt.Valid {
+		report.ResolvedAt = &dbReport.ResolvedAt.Time
+	}
+	if dbReport.ResolvedBy.Valid {
+		report.ResolvedBy = &dbReport.ResolvedBy.UUID
+	}
+	return report
+}
+
+// ReportChirp reports the chirp in the path to the moderators with a "reason"
+// category and optional "details". A user can have one open report per
+// chirp, and cannot report it again once a moderator dismissed their report,
+// so that the same users cannot hide it again right after the review. Once
+// ReportHideThreshold users have reported a chirp it is hidden until a
+// moderator reviews it.
+func (config *APIConfig) ReportChirp(writer http.ResponseWriter, request *http.Request) {
+	type ReportRequest struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Report must be a POST request")
+		return
+	}
+
+	reporterID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	var reportRequest ReportRequest
+	err = json.NewDecoder(request.Body).Decode(&reportRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !slices.Contains(reportReasons, reportRequest.Reason) {
+		respondWithError(writer, http.StatusBadRequest, "Reason must be one of "+strings.Join(reportReasons, ", "))
+		return
+	}
+	details := strings.TrimSpace(reportRequest.Details)
+	if len(details) > maxReportDetailsLength {
+		respondWithError(writer, http.StatusBadRequest, "Details are too long")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	// Locking the chirp before adding the report makes concurrent reports
+	// count one after the other, so that the one reaching the threshold
+	// sees all the others.
+	dbChirp, err := queries.GetChirpByIDForUpdate(context.Background(), chirpID)
+	if err != nil || !canSeeChirp(request, dbChirp) {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if dbChirp.UserID == reporterID {
+		respondWithError(writer, http.StatusBadRequest, "You cannot report your own chirp")
+		return
+	}
+	dismissed, err := queries.HasDismissedReport(context.Background(), database.HasDismissedReportParams{
+		ChirpID:    uuid.NullUUID{UUID: chirpID, Valid: true},
+		ReporterID: reporterID,
+	})
+	if err != nil {
+		log.Printf("Failed to check dismissed reports: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+	if dismissed {
+		respondWithError(writer, http.StatusConflict, "A moderator already reviewed your report of this chirp")
+		return
+	}
+	dbReport, err := queries.CreateReport(context.Background(), database.CreateReportParams{
+		ChirpID:    uuid.NullUUID{UUID: chirpID, Valid: true},
+		ReporterID: reporterID,
+		Reason:     reportRequest.Reason,
+		Details:    sql.NullString{String: details, Valid: details != ""},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusConflict, "You already reported this chirp")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create report: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+	err = config.autoHideChirp(queries, dbChirp)
+	if err != nil {
+		log.Printf("Failed to check report threshold: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit report: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+	respondWithJSON(writer, http.StatusCreated, reportFromDatabase(dbReport))
+}
+
+// autoHideChirp hides a chirp once ReportHideThreshold users have open
+// reports about it, and records the action without a moderator. The chirp
+// must have been locked in the transaction of queries.
+func (config *APIConfig) autoHideChirp(queries *database.Queries, dbChirp database.Chirp) error {
+	if config.ReportHideThreshold <= 0 || dbChirp.HiddenAt.Valid {
+		return nil
+	}
+	openReports, err := queries.CountOpenReports(context.Background(), uuid.NullUUID{UUID: dbChirp.ID, Valid: true})
+	if err != nil {
+		return err
+	}
+	if openReports < int64(config.ReportHideThreshold) {
+		return nil
+	}
+
+	hidden, err := queries.HideChirp(context.Background(), dbChirp.ID)
+	if err != nil || hidden == 0 {
+		return err
+	}
+	log.Printf("Chirp %v hidden after %d reports", dbChirp.ID, openReports)
+	return queries.CreateModerationAction(context.Background(), database.CreateModerationActionParams{
+		Action:       moderationAutoHide,
+		ChirpID:      uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: dbChirp.UserID, Valid: true},
+		Note:         sql.NullString{String: fmt.Sprintf("reported by %d users", openReports), Valid: true},
+	})
+}
+
+// ListReports is the moderation queue: reports with a "status" (open by
+// default, or dismissed or actioned), oldest first, optionally of one
+// "reason". It is paginated with "limit" and "cursor".
+func (config *APIConfig) ListReports(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListReportsParams{
+		Status: reportOpen,
+		Limit:  int32(limit + 1),
+	}
+	if status := query.Get("status"); status != "" {
+		if status != reportOpen && status != reportDismissed && status != reportActioned {
+			respondWithError(writer, http.StatusBadRequest, "Status must be open, dismissed or actioned")
+			return
+		}
+		params.Status = status
+	}
+	if reason := query.Get("reason"); reason != "" {
+		if !slices.Contains(reportReasons, reason) {
+			respondWithError(writer, http.StatusBadRequest, "Reason must be one of "+strings.Join(reportReasons, ", "))
+			return
+		}
+		params.Reason = sql.NullString{String: reason, Valid: true}
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	rows, err := config.Queries.ListReports(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to list reports: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list reports")
+		return
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	reports := make([]Report, 0, len(rows))
+	for _, row := range rows {
+		report := reportFromDatabase(database.Report{
+			ID:         row.ID,
+			ChirpID:    row.ChirpID,
+			ReporterID: row.ReporterID,
+			Reason:     row.Reason,
+			Details:    row.Details,
+			Status:     row.Status,
+			CreatedAt:  row.CreatedAt,
+			ResolvedAt: row.ResolvedAt,
+			ResolvedBy: row.ResolvedBy,
+		})
+		if row.ChirpAuthorID.Valid {
+			report.Chirp = &ReportedChirp{UserID: row.ChirpAuthorID.UUID, Body: row.ChirpBody.String}
+			if row.ChirpHiddenAt.Valid {
+				report.Chirp.HiddenAt = &row.ChirpHiddenAt.Time
+			}
+		}
+		report.OpenReportCount = row.OpenReportCount
+		reports = append(reports, report)
+	}
+	respondWithJSON(writer, http.StatusOK, reports)
+}
+
+// ResolveReport applies a moderator's decision to the report in the path and
+// to every other open report of the same chirp. The "action" is one of:
+//
+//   - dismiss: the chirp is fine, and is shown again if reports hid it (but
+//     not if a moderator did)
+//   - hide_chirp: the chirp is hidden from everyone but its author
+//   - delete_chirp: the chirp is deleted
+//   - suspend_author: the author of the chirp is suspended
+//
+// An optional "note" is kept with the action, and is the suspension reason
+// for suspend_author.
+func (config *APIConfig) ResolveReport(writer http.ResponseWriter, request *http.Request) {
+	type ResolveRequest struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+	}
+
+	moderator, ok := PrincipalFromContext(request.Context())
+	if !ok {
+		respondUnauthorized(writer, errMissingToken)
+		return
+	}
+
+	reportID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid report ID format")
+		return
+	}
+
+	var resolveRequest ResolveRequest
+	err = json.NewDecoder(request.Body).Decode(&resolveRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	note := strings.TrimSpace(resolveRequest.Note)
+	if len(note) > maxSuspensionReasonLength {
+		respondWithError(writer, http.StatusBadRequest, "Note is too long")
+		return
+	}
+	switch resolveRequest.Action {
+	case moderationDismiss, moderationHideChirp:
+	case moderationDeleteChirp:
+		if !moderator.HasPermission(auth.PermissionDeleteAnyChirp) {
+			respondWithError(writer, http.StatusForbidden, "You do not have permission to delete chirps")
+			return
+		}
+	case moderationSuspendAuthor:
+	default:
+		respondWithError(writer, http.StatusBadRequest, "Action must be dismiss, hide_chirp, delete_chirp or suspend_author")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	dbReport, err := queries.GetReportForUpdate(context.Background(), reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "Report not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get report %v: %v", reportID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+	if dbReport.Status != reportOpen {
+		respondWithError(writer, http.StatusConflict, "Report is already resolved")
+		return
+	}
+	action := database.CreateModerationActionParams{
+		ModeratorID: uuid.NullUUID{UUID: moderator.UserID, Valid: true},
+		Action:      resolveRequest.Action,
+		ReportID:    uuid.NullUUID{UUID: reportID, Valid: true},
+		Note:        sql.NullString{String: note, Valid: note != ""},
+	}
+
+	if !dbReport.ChirpID.Valid {
+		// The chirp was deleted after it was reported; there is nothing left
+		// to act on.
+		if resolveRequest.Action != moderationDismiss {
+			respondWithError(writer, http.StatusConflict, "The reported chirp was deleted, the report can only be dismissed")
+			return
+		}
+		err = queries.ResolveReport(context.Background(), database.ResolveReportParams{
+			Status:     reportDismissed,
+			ResolvedBy: action.ModeratorID,
+			ID:         reportID,
+		})
+		if err == nil {
+			err = queries.CreateModerationAction(context.Background(), action)
+		}
+	} else {
+		var dbChirp database.Chirp
+		dbChirp, err = queries.GetChirpByID(context.Background(), dbReport.ChirpID.UUID)
+		if err != nil {
+			log.Printf("Failed to get reported chirp %v: %v", dbReport.ChirpID.UUID, err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+			return
+		}
+		if resolveRequest.Action == moderationSuspendAuthor && !config.canSuspend(writer, moderator, dbChirp.UserID) {
+			return
+		}
+
+		action.ChirpID = uuid.NullUUID{UUID: dbChirp.ID, Valid: true}
+		action.TargetUserID = uuid.NullUUID{UUID: dbChirp.UserID, Valid: true}
+		status := reportActioned
+		if resolveRequest.Action == moderationDismiss {
+			status = reportDismissed
+		}
+		// Dismissing only overturns a hide that reports caused, not one a
+		// moderator decided. Check before recording the dismissal.
+		unhide := false
+		if resolveRequest.Action == moderationDismiss && dbChirp.HiddenAt.Valid {
+			var latestHide string
+			latestHide, err = queries.GetLatestHideAction(context.Background(), action.ChirpID)
+			unhide = err == nil && latestHide == moderationAutoHide
+			if errors.Is(err, sql.ErrNoRows) {
+				err = nil
+			}
+		}
+		if err == nil {
+			err = recordModeration(queries, action, status)
+		}
+		if err == nil {
+			switch resolveRequest.Action {
+			case moderationDismiss:
+				if unhide {
+					err = queries.UnhideChirp(context.Background(), dbChirp.ID)
+				}
+			case moderationHideChirp:
+				_, err = queries.HideChirp(context.Background(), dbChirp.ID)
+			case moderationDeleteChirp:
+				err = queries.DeleteOneChirps(context.Background(), dbChirp.ID)
+			case moderationSuspendAuthor:
+				_, err = suspendUser(queries, dbChirp.UserID, note)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to %s for report %v: %v", resolveRequest.Action, reportID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit moderation action: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+	log.Printf("Moderator %v resolved report %v: %s", moderator.UserID, reportID, resolveRequest.Action)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// recordModeration resolves every open report of the chirp in action with
+// status, and records the action in the audit log. Call it before deleting
+// the chirp, in the same transaction as the action itself.
+func recordModeration(queries *database.Queries, action database.CreateModerationActionParams, status string) error {
+	_, err := queries.ResolveChirpReports(context.Background(), database.ResolveChirpReportsParams{
+		Status:     status,
+		ResolvedBy: action.ModeratorID,
+		ChirpID:    action.ChirpID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resolve reports of chirp %v: %w", action.ChirpID.UUID, err)
+	}
+	err = queries.CreateModerationAction(context.Background(), action)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	return nil
+}
+
+// canSuspend checks that a moderator may suspend the author of a reported
+// chirp: not themselves, and not another moderator or admin unless they may
+// manage users. When it returns false an error response has already been
+// written.
+func (config *APIConfig) canSuspend(writer http.ResponseWriter, moderator Principal, authorID uuid.UUID) bool {
+	if authorID == moderator.UserID {
+		respondWithError(writer, http.StatusBadRequest, "You cannot suspend your own account")
+		return false
+	}
+	if moderator.HasPermission(auth.PermissionManageUsers) {
+		return true
+	}
+	roles, err := config.Queries.ListUserRoles(context.Background(), authorID)
+	if err != nil {
+		log.Printf("Failed to list roles of user %v: %v", authorID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to resolve report")
+		return false
+	}
+	if len(roles) > 0 {
+		respondWithError(writer, http.StatusForbidden, "Only admins can suspend moderators and admins")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// EditChirp replaces the body of a chirp owned by the authenticated user. The
+// new body goes through the same checks as a new chirp, and the previous body
+// is kept as a revision.
+func (config *APIConfig) EditChirp(writer http.ResponseWriter, request *http.Request) {
+	type EditChirpRequest struct {
+		Body string `json:"body"`
+	}
+	if request.Method != http.MethodPatch {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Chirp edit must be a PATCH request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	var editRequest EditChirpRequest
+	err = json.NewDecoder(request.Body).Decode(&editRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Chirp must be a valid JSON object")
+		return
+	}
+	checked, err := config.checkChirpBody(editRequest.Body)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Chirp is too long.")
+		return
+	}
+	if checked.Rejected {
+		respondWithError(writer, http.StatusUnprocessableEntity, "Chirp contains words that are not allowed")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to edit chirp")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	dbChirp, err := queries.GetChirpByIDForUpdate(context.Background(), chirpID)
+	if err != nil {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if dbChirp.UserID != userID {
+		log.Printf("User %v is not authorized to edit chirp %v", userID, chirpID)
+		respondWithError(writer, http.StatusForbidden, "You are not authorized to edit this chirp")
+		return
+	}
+	if dbChirp.RechirpOf.Valid {
+		respondWithError(writer, http.StatusBadRequest, "Rechirps cannot be edited")
+		return
+	}
+
+	if checked.Body != dbChirp.Body {
+		err = queries.CreateChirpRevision(context.Background(), database.CreateChirpRevisionParams{
+			ChirpID:   dbChirp.ID,
+			Body:      dbChirp.Body,
+			CreatedAt: dbChirp.UpdatedAt,
+		})
+		if err != nil {
+			log.Printf("Failed to save chirp revision: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to edit chirp")
+			return
+		}
+		dbChirp, err = queries.UpdateChirpBody(context.Background(), database.UpdateChirpBodyParams{
+			Body: checked.Body,
+			ID:   dbChirp.ID,
+		})
+		if err != nil {
+			log.Printf("Failed to update chirp: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to edit chirp")
+			return
+		}
+		err = saveChirpEntities(queries, dbChirp)
+		if err != nil {
+			log.Printf("Failed to save chirp entities: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to edit chirp")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit chirp edit: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to edit chirp")
+		return
+	}
+
+	if checked.Flagged {
+		config.flagChirp(dbChirp.ID, checked)
+	}
+
+	chirps, err := config.chirpsFromDatabase([]database.Chirp{dbChirp}, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to load edited chirp")
+		return
+	}
+	log.Printf("Chirp %v edited by user %v", chirpID, userID)
+	respondWithJSON(writer, http.StatusOK, chirps[0])
+}
+
+// GetChirpHistory lists the previous versions of a chirp, newest first.
+func (config *APIConfig) GetChirpHistory(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "History must be a GET request")
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	dbChirp, err := config.Queries.GetChirpByID(context.Background(), chirpID)
+	if err != nil || !canSeeChirp(request, dbChirp) {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	dbRevisions, err := config.Queries.ListChirpRevisions(context.Background(), chirpID)
+	if err != nil {
+		log.Printf("Failed to list chirp revisions: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get chirp history")
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, dbRevision := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			Body:       dbRevision.Body,
+			CreatedAt:  dbRevision.CreatedAt,
+			ReplacedAt: dbRevision.ReplacedAt,
+		})
+	}
+	respondWithJSON(writer, http.StatusOK, revisions)
+}
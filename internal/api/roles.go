@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// userRoles returns every role of a user: the implicit user role followed by
+// the roles granted in user_roles.
+func (config *APIConfig) userRoles(userID uuid.UUID) ([]string, error) {
+	granted, err := config.Queries.ListUserRoles(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{string(auth.RoleUser)}, granted...), nil
+}
+
+// GetUserRoles lists the roles of the user in the path.
+func (config *APIConfig) GetUserRoles(writer http.ResponseWriter, request *http.Request) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	_, err = config.Queries.GetUserById(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list roles")
+		return
+	}
+
+	roles, err := config.userRoles(userID)
+	if err != nil {
+		log.Printf("Failed to list roles of user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list roles")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, UserRoles{UserID: userID, Roles: roles})
+}
+
+// GrantUserRole gives the user in the path a role. Granting a role twice is a
+// no-op. The user's access tokens pick it up when they are next refreshed.
+func (config *APIConfig) GrantUserRole(writer http.ResponseWriter, request *http.Request) {
+	userID, role, ok := parseUserRole(writer, request)
+	if !ok {
+		return
+	}
+	_, err := config.Queries.GetUserById(context.Background(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get user %v: %v", userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to grant role")
+		return
+	}
+
+	err = config.Queries.GrantUserRole(context.Background(), database.GrantUserRoleParams{UserID: userID, Role: string(role)})
+	if err != nil {
+		log.Printf("Failed to grant role %s to user %v: %v", role, userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to grant role")
+		return
+	}
+	log.Printf("Role %s granted to user %v", role, userID)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserRole takes a role away from the user in the path. Access tokens
+// already issued keep the role until they expire, within the hour.
+func (config *APIConfig) RevokeUserRole(writer http.ResponseWriter, request *http.Request) {
+	userID, role, ok := parseUserRole(writer, request)
+	if !ok {
+		return
+	}
+
+	revoked, err := config.Queries.RevokeUserRole(context.Background(), database.RevokeUserRoleParams{UserID: userID, Role: string(role)})
+	if err != nil {
+		log.Printf("Failed to revoke role %s from user %v: %v", role, userID, err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke role")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(writer, http.StatusNotFound, "User does not have this role")
+		return
+	}
+	log.Printf("Role %s revoked from user %v", role, userID)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// parseUserRole reads the user ID and the role from the path. The user role
+// is implicit and cannot be granted or revoked. When it returns false an error
+// response has already been written.
+func parseUserRole(writer http.ResponseWriter, request *http.Request) (uuid.UUID, auth.Role, bool) {
+	userID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid user ID format")
+		return uuid.Nil, "", false
+	}
+	role, err := auth.ParseRole(request.PathValue("role"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return uuid.Nil, "", false
+	}
+	if role == auth.RoleUser {
+		respondWithError(writer, http.StatusBadRequest, "Every account has the user role")
+		return uuid.Nil, "", false
+	}
+	return userID, role, true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// SearchChirps runs a full-text search over chirp bodies. Results are ordered
+// by relevance, then newest first, and can be narrowed down with "author_id",
+// "since" and "until" (RFC 3339 timestamps).
+func (config *APIConfig) SearchChirps(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Search must be a GET request")
+		return
+	}
+
+	query := request.URL.Query()
+	search := query.Get("q")
+	if search == "" {
+		respondWithError(writer, http.StatusBadRequest, "Search query 'q' is required")
+		return
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Search: search,
+		Limit:  int32(limit + 1),
+	}
+
+	if authorID := query.Get("author_id"); authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid author_id format")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorUUID, Valid: true}
+	}
+
+	if since := query.Get("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid since format, expected RFC 3339")
+			return
+		}
+		params.Since = sql.NullTime{Time: sinceTime.UTC(), Valid: true}
+	}
+
+	if until := query.Get("until"); until != "" {
+		untilTime, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid until format, expected RFC 3339")
+			return
+		}
+		params.Until = sql.NullTime{Time: untilTime.UTC(), Valid: true}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeRankedCursor(cursor)
+		if err != nil {
+			respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		params.AfterRank = sql.NullFloat64{Float64: float64(after.Rank), Valid: true}
+		params.AfterCreatedAt = sql.NullTime{Time: after.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: after.ID, Valid: true}
+	}
+
+	rows, err := config.Queries.SearchChirps(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to search chirps: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		setNextLink(writer, request, encodeRankedCursor(rankedCursor{
+			Rank:       last.Rank,
+			pageCursor: pageCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+		}))
+	}
+
+	dbChirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		dbChirps = append(dbChirps, database.Chirp{
+			ID:        row.ID,
+			UserID:    row.UserID,
+			Body:      row.Body,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			InReplyTo: row.InReplyTo,
+			RechirpOf: row.RechirpOf,
+			QuoteOf:   row.QuoteOf,
+		})
+	}
+	chirps, err := config.chirpsFromDatabase(dbChirps, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, chirps)
+}
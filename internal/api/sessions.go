@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+const maxDeviceLabelLength = 100
+
+// sessionInfo describes the session a refresh token belongs to. Rotated
+// tokens keep the ID, start time and label of their session and record the
+// user agent and address of the latest refresh.
+type sessionInfo struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	DeviceLabel string
+	UserAgent   string
+	IPAddress   string
+}
+
+// newSession starts a session for a login made with the request.
+func (config *APIConfig) newSession(request *http.Request, deviceLabel string) sessionInfo {
+	return sessionInfo{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		DeviceLabel: deviceLabel,
+		UserAgent:   request.UserAgent(),
+		IPAddress:   config.ClientIP(request),
+	}
+}
+
+// ClientIP returns the address of the client that sent the request. When the
+// peer is one of TrustedProxies, X-Forwarded-For is read from the right and
+// the first address not added by a trusted proxy is used; a malformed entry
+// stops the walk at the proxy that forwarded it. Otherwise the header is
+// ignored because any client can set it.
+func (config *APIConfig) ClientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	if !config.trustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		host = hop
+		if !config.trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether address is in one of TrustedProxies.
+func (config *APIConfig) trustedProxy(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListSessions lists the caller's signed-in devices, most recently used first.
+func (config *APIConfig) ListSessions(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Sessions must be a GET request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	dbTokens, err := config.Queries.ListSessions(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to list sessions: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	sessions := make([]Session, 0, len(dbTokens))
+	for _, dbToken := range dbTokens {
+		sessions = append(sessions, Session{
+			ID:          dbToken.SessionID,
+			DeviceLabel: dbToken.DeviceLabel,
+			UserAgent:   dbToken.UserAgent,
+			IPAddress:   dbToken.IpAddress,
+			CreatedAt:   dbToken.SessionCreatedAt,
+			LastUsedAt:  dbToken.CreatedAt,
+		})
+	}
+	respondWithJSON(writer, http.StatusOK, sessions)
+}
+
+// RevokeSession signs one of the caller's devices out. Access tokens already
+// handed to the device stay valid until they expire.
+func (config *APIConfig) RevokeSession(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Session revocation must be a DELETE request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid session ID format")
+		return
+	}
+
+	revoked, err := config.Queries.RevokeSession(context.Background(), database.RevokeSessionParams{
+		UserID:    userID,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke session: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(writer, http.StatusNotFound, "Session not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs every device of the caller out, including the one
+// making the request.
+func (config *APIConfig) RevokeAllSessions(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Session revocation must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	err := config.Queries.RevokeAllRefreshTokensForUser(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to revoke sessions: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
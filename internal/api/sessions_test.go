@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/jrmts/Chrispy/internal/api"
+)
+
+func TestClientIP(t *testing.T) {
+	config := &api.APIConfig{
+		TrustedProxies: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("2001:db8::1/128"),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{
+			name:       "No proxy",
+			remoteAddr: "203.0.113.7:4321",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "Untrusted peer with a spoofed header",
+			remoteAddr:   "203.0.113.7:4321",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "Trusted peer",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:       "Trusted peer without a header",
+			remoteAddr: "10.0.0.1:80",
+			want:       "10.0.0.1",
+		},
+		{
+			name:         "Chain of trusted proxies",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"198.51.100.1, 10.0.0.3, 10.0.0.2"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Address spoofed by the client before the proxies",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"192.0.2.66, 198.51.100.1, 10.0.0.2"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Malformed hop",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"198.51.100.1, not-an-address, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:         "Multiple header lines",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"192.0.2.66", "198.51.100.1, 10.0.0.3", "10.0.0.2"},
+			want:         "198.51.100.1",
+		},
+		{
+			name:         "Trusted IPv6 peer",
+			remoteAddr:   "[2001:db8::1]:443",
+			forwardedFor: []string{"2001:db8::42"},
+			want:         "2001:db8::42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			if got := config.ClientIP(request); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	untrusting := &api.APIConfig{}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.1:80"
+	request.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := untrusting.ClientIP(request); got != "10.0.0.1" {
+		t.Errorf("ClientIP() without trusted proxies = %q, want %q", got, "10.0.0.1")
+	}
+}
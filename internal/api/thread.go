@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// GetChirpThread returns a chirp with the chain of chirps it replies to and a
+// page of its replies (direct and nested), oldest first. Replies are paginated
+// with "limit" and "cursor" like GetChirps.
+func (config *APIConfig) GetChirpThread(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Thread must be a GET request")
+		return
+	}
+
+	chirpID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	query := request.URL.Query()
+	limit, err := parseLimit(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpDescendantsParams{
+		RootID: chirpID,
+		Limit:  int32(limit + 1),
+	}
+	params.AfterCreatedAt, params.AfterID, err = parseCursor(query)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+
+	dbChirp, err := config.Queries.GetChirpByID(context.Background(), chirpID)
+	if err != nil {
+		log.Printf("Failed to get chirp by ID: %v", err)
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if !canSeeChirp(request, dbChirp) {
+		respondWithError(writer, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	dbAncestors, err := config.Queries.GetChirpAncestors(context.Background(), chirpID)
+	if err != nil {
+		log.Printf("Failed to get chirp ancestors: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get thread")
+		return
+	}
+
+	dbReplies, err := config.Queries.ListChirpDescendants(context.Background(), params)
+	if err != nil {
+		log.Printf("Failed to get chirp replies: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get thread")
+		return
+	}
+	if len(dbReplies) > limit {
+		dbReplies = dbReplies[:limit]
+		last := dbReplies[len(dbReplies)-1]
+		setNextLink(writer, request, encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+	}
+
+	// Convert everything in one go so the reply counts come from a single query.
+	all := make([]database.Chirp, 0, len(dbAncestors)+1+len(dbReplies))
+	all = append(all, dbAncestors...)
+	all = append(all, dbChirp)
+	all = append(all, dbReplies...)
+	chirps, err := config.chirpsFromDatabase(all, viewerID(request))
+	if err != nil {
+		log.Printf("Failed to load chirp details: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to get thread")
+		return
+	}
+
+	respondWithJSON(writer, http.StatusOK, ChirpThread{
+		Ancestors: chirps[:len(dbAncestors)],
+		Chirp:     chirps[len(dbAncestors)],
+		Replies:   chirps[len(dbAncestors)+1:],
+	})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+const maxTokenNameLength = 100
+
+func personalAccessTokenFromDatabase(dbToken database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		ID:        dbToken.ID,
+		Name:      dbToken.Name,
+		Scopes:    dbToken.Scopes,
+		CreatedAt: dbToken.CreatedAt,
+	}
+	if dbToken.ExpiresAt.Valid {
+		token.ExpiresAt = &dbToken.ExpiresAt.Time
+	}
+	if dbToken.LastUsedAt.Valid {
+		token.LastUsedAt = &dbToken.LastUsedAt.Time
+	}
+	return token
+}
+
+// CreatePersonalAccessToken creates an API token for the caller with the
+// requested scopes. The token is only shown in this response. Creating tokens
+// takes a login: personal access tokens cannot create more tokens.
+func (config *APIConfig) CreatePersonalAccessToken(writer http.ResponseWriter, request *http.Request) {
+	type CreateTokenRequest struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Token creation must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	var tokenRequest CreateTokenRequest
+	err := json.NewDecoder(request.Body).Decode(&tokenRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if tokenRequest.Name == "" || len(tokenRequest.Name) > maxTokenNameLength {
+		respondWithError(writer, http.StatusBadRequest, "Name is required and must be at most 100 characters")
+		return
+	}
+	scopes, err := auth.ParseScopes(tokenRequest.Scopes)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if tokenRequest.ExpiresInDays < 0 {
+		respondWithError(writer, http.StatusBadRequest, "expires_in_days must not be negative")
+		return
+	}
+	var expiresAt sql.NullTime
+	if tokenRequest.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, tokenRequest.ExpiresInDays), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Failed to generate personal access token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+	dbToken, err := config.Queries.CreatePersonalAccessToken(context.Background(), database.CreatePersonalAccessTokenParams{
+		UserID:    userID,
+		Name:      tokenRequest.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Failed to save personal access token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+
+	response := personalAccessTokenFromDatabase(dbToken)
+	response.Token = token
+	respondWithJSON(writer, http.StatusCreated, response)
+}
+
+// ListPersonalAccessTokens lists the caller's tokens that have not been
+// revoked, newest first.
+func (config *APIConfig) ListPersonalAccessTokens(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Tokens must be a GET request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	dbTokens, err := config.Queries.ListPersonalAccessTokens(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to list personal access tokens: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to list tokens")
+		return
+	}
+
+	tokens := make([]PersonalAccessToken, 0, len(dbTokens))
+	for _, dbToken := range dbTokens {
+		tokens = append(tokens, personalAccessTokenFromDatabase(dbToken))
+	}
+	respondWithJSON(writer, http.StatusOK, tokens)
+}
+
+// RevokePersonalAccessToken revokes one of the caller's tokens.
+func (config *APIConfig) RevokePersonalAccessToken(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodDelete {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Token revocation must be a DELETE request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	tokenID, err := uuid.Parse(request.PathValue("id"))
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid token ID format")
+		return
+	}
+
+	revoked, err := config.Queries.RevokePersonalAccessToken(context.Background(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke personal access token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke token")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(writer, http.StatusNotFound, "Token not found")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/totp"
+)
+
+const (
+	totpIssuer         = "Chirpy"
+	challengeExpiresIn = 5 * time.Minute
+	recoveryCodeCount  = 10
+)
+
+// twoFactorRequest carries the second factor: a code from the authenticator
+// app or, when the device is lost, one of the recovery codes.
+type twoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// respondWithTwoFactorChallenge answers the password step of a login for a
+// user with two-factor authentication enabled.
+func (config *APIConfig) respondWithTwoFactorChallenge(writer http.ResponseWriter, userID uuid.UUID) {
+	challenge, err := auth.MakeChallengeJWT(userID, config.SecretKey, challengeExpiresIn)
+	if err != nil {
+		log.Printf("Failed to create challenge token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create challenge token")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, TwoFactorChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresAt:         time.Now().Add(challengeExpiresIn),
+	})
+}
+
+// checkSecondFactor reports whether the request carries a valid code for the
+// user. Authenticator codes and recovery codes are accepted only once.
+func (config *APIConfig) checkSecondFactor(dbUser database.User, factor twoFactorRequest) (bool, error) {
+	if factor.Code != "" {
+		secret, err := auth.DecryptSecret(config.TOTPKey, dbUser.TotpSecret)
+		if err != nil {
+			return false, err
+		}
+		step, ok := totp.Validate(secret, factor.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		used, err := config.Queries.UseTotpStep(context.Background(), database.UseTotpStepParams{
+			ID:           dbUser.ID,
+			TotpLastStep: step,
+		})
+		return used == 1, err
+	}
+	if factor.RecoveryCode != "" {
+		used, err := config.Queries.UseRecoveryCode(context.Background(), database.UseRecoveryCodeParams{
+			UserID:   dbUser.ID,
+			CodeHash: totp.HashRecoveryCode(factor.RecoveryCode),
+		})
+		return used == 1, err
+	}
+	return false, nil
+}
+
+// LoginTwoFactor completes a login started with LoginUser by exchanging the
+// challenge token and a second factor for the usual tokens.
+func (config *APIConfig) LoginTwoFactor(writer http.ResponseWriter, request *http.Request) {
+	type LoginTwoFactorRequest struct {
+		ChallengeToken string `json:"challenge_token"`
+		DeviceLabel    string `json:"device_label"`
+		twoFactorRequest
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusBadRequest, "Only POST method is allowed")
+		return
+	}
+
+	var loginRequest LoginTwoFactorRequest
+	err := json.NewDecoder(request.Body).Decode(&loginRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(loginRequest.DeviceLabel) > maxDeviceLabelLength {
+		respondWithError(writer, http.StatusBadRequest, "Device label is too long")
+		return
+	}
+
+	userID, err := auth.ValidateChallengeJWT(loginRequest.ChallengeToken, config.SecretKey)
+	if err != nil {
+		log.Printf("Failed to validate challenge token: %v", err)
+		respondWithError(writer, http.StatusUnauthorized, "Invalid or expired challenge token")
+		return
+	}
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		respondWithError(writer, http.StatusUnauthorized, "Invalid or expired challenge token")
+		return
+	}
+	if config.rejectSuspendedLogin(writer, request, dbUser) {
+		return
+	}
+	if !dbUser.TotpEnabled {
+		// Two-factor authentication was disabled since the challenge was
+		// issued. The challenge alone must not log in, so the password step
+		// has to be done again.
+		respondWithError(writer, http.StatusUnauthorized, "Two-factor authentication is off, start the login again")
+		return
+	}
+
+	loginUserID := uuid.NullUUID{UUID: dbUser.ID, Valid: true}
+	if !config.checkLoginThrottle(writer, request, dbUser.Email, loginUserID) {
+		return
+	}
+	ok, err := config.checkSecondFactor(dbUser, loginRequest.twoFactorRequest)
+	if err != nil {
+		log.Printf("Failed to check second factor: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to check code")
+		return
+	}
+	if !ok {
+		config.failLogin(writer, request, dbUser.Email, loginUserID, loginWrongCode, "Invalid code")
+		return
+	}
+	config.succeedLogin(request, dbUser)
+	config.respondWithLogin(writer, request, dbUser, loginRequest.DeviceLabel)
+}
+
+// SetupTwoFactor starts enrolling an authenticator app for the caller. The
+// secret is not used for logins until ConfirmTwoFactor succeeds.
+func (config *APIConfig) SetupTwoFactor(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Two-factor setup must be a POST request")
+		return
+	}
+	if len(config.TOTPKey) == 0 {
+		respondWithError(writer, http.StatusForbidden, "Two-factor authentication is disabled")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+	if dbUser.TotpEnabled {
+		respondWithError(writer, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+	encrypted, err := auth.EncryptSecret(config.TOTPKey, secret)
+	if err != nil {
+		log.Printf("Failed to encrypt TOTP secret: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+	err = config.Queries.SetTotpSecret(context.Background(), database.SetTotpSecretParams{
+		ID:         userID,
+		TotpSecret: encrypted,
+	})
+	if err != nil {
+		log.Printf("Failed to save TOTP secret: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+
+	respondWithJSON(writer, http.StatusOK, TwoFactorSetup{
+		Secret:     totp.EncodeSecret(secret),
+		OTPAuthURI: totp.URI(totpIssuer, dbUser.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the caller proves
+// their authenticator app works, and returns a fresh set of recovery codes.
+// The codes are only shown here.
+func (config *APIConfig) ConfirmTwoFactor(writer http.ResponseWriter, request *http.Request) {
+	type ConfirmTwoFactorRequest struct {
+		Code string `json:"code"`
+	}
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Two-factor confirmation must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	var confirmRequest ConfirmTwoFactorRequest
+	err := json.NewDecoder(request.Body).Decode(&confirmRequest)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to confirm two-factor authentication")
+		return
+	}
+	if dbUser.TotpEnabled {
+		respondWithError(writer, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if dbUser.TotpSecret == nil {
+		respondWithError(writer, http.StatusBadRequest, "Two-factor setup has not been started")
+		return
+	}
+
+	secret, err := auth.DecryptSecret(config.TOTPKey, dbUser.TotpSecret)
+	if err != nil {
+		log.Printf("Failed to decrypt TOTP secret: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to confirm two-factor authentication")
+		return
+	}
+	step, ok := totp.Validate(secret, confirmRequest.Code, time.Now())
+	if !ok {
+		respondWithError(writer, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	codes, err := config.enableTwoFactor(userID, step)
+	if err != nil {
+		log.Printf("Failed to enable two-factor authentication: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to confirm two-factor authentication")
+		return
+	}
+	respondWithJSON(writer, http.StatusOK, map[string][]string{
+		"recovery_codes": codes,
+	})
+}
+
+// enableTwoFactor turns two-factor authentication on and replaces the user's
+// recovery codes, returning the new ones.
+func (config *APIConfig) enableTwoFactor(userID uuid.UUID, step int64) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	err = queries.EnableTotp(context.Background(), database.EnableTotpParams{
+		ID:           userID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = queries.DeleteRecoveryCodes(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err = queries.CreateRecoveryCode(context.Background(), database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: totp.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// DisableTwoFactor turns two-factor authentication off for the caller. It
+// takes a current code or a recovery code, so a stolen access token alone is
+// not enough.
+func (config *APIConfig) DisableTwoFactor(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Two-factor disable must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	var factor twoFactorRequest
+	err := json.NewDecoder(request.Body).Decode(&factor)
+	if err != nil {
+		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	if !dbUser.TotpEnabled {
+		respondWithError(writer, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+
+	ok, err = config.checkSecondFactor(dbUser, factor)
+	if err != nil {
+		log.Printf("Failed to check second factor: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to check code")
+		return
+	}
+	if !ok {
+		respondWithError(writer, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	err = queries.DisableTotp(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to disable two-factor authentication: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	err = queries.DeleteRecoveryCodes(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to delete recovery codes: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit two-factor disable: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
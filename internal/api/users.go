@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -27,14 +29,20 @@ func (config *APIConfig) CreateUser(writer http.ResponseWriter, request *http.Re
 		respondWithError(writer, http.StatusBadRequest, "Email is required")
 		return
 	}
+	if validateEmail(user.Email) != nil {
+		respondWithError(writer, http.StatusBadRequest, "Email is not a valid address")
+		return
+	}
 	if user.Password == "" {
 		respondWithError(writer, http.StatusBadRequest, "Password is required")
 		return
 	}
-	user.HashedPassword, err = auth.HashPassword(user.Password)
+	if !config.checkPassword(writer, user.Password) {
+		return
+	}
+	user.HashedPassword, err = config.PasswordHasher.Hash(user.Password)
 	if err != nil {
-		log.Printf("Failed to hash password: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to hash password")
+		respondWithHashError(writer, err)
 		return
 	}
 	// user.ID = uuid.New()
@@ -51,13 +59,19 @@ func (config *APIConfig) CreateUser(writer http.ResponseWriter, request *http.Re
 		respondWithError(writer, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
+	err = config.sendVerificationEmail(dbUser)
+	if err != nil {
+		// The user can ask for another email, so the account stays.
+		log.Printf("Failed to send verification email: %v", err)
+	}
 	// writer.WriteHeader(http.StatusCreated)
 	respondWithJSON(writer, http.StatusCreated, User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
 	})
 	log.Printf("User created successfully: %v", dbUser)
 }
@@ -78,6 +92,10 @@ func (config *APIConfig) LoginUser(writer http.ResponseWriter, request *http.Req
 		respondWithError(writer, http.StatusUnauthorized, "Email and password are required")
 		return
 	}
+	if len(user.DeviceLabel) > maxDeviceLabelLength {
+		respondWithError(writer, http.StatusBadRequest, "Device label is too long")
+		return
+	}
 	// if user.ExpiresAt == 0 {
 	// 	user.ExpiresAt = 60 * 60 // Set default expiration to 1 hour
 	// } else if user.ExpiresAt > 60*60 {
@@ -85,69 +103,123 @@ func (config *APIConfig) LoginUser(writer http.ResponseWriter, request *http.Req
 	// }
 	// user.ExpiresAt = time.Now().Add(1 * time.Hour)
 
+	if !config.checkLoginThrottle(writer, request, user.Email, uuid.NullUUID{}) {
+		return
+	}
+
 	dbUser, err := config.Queries.GetUserByEmail(context.Background(), user.Email)
 	if err != nil {
 		log.Printf("Failed to get user by email: %v", err)
-		respondWithError(writer, http.StatusUnauthorized, "Failed to get user")
+		config.failLogin(writer, request, user.Email, uuid.NullUUID{}, loginUnknownEmail, "Failed to get user")
 		return
 	}
+	loginUserID := uuid.NullUUID{UUID: dbUser.ID, Valid: true}
 
 	// hashedPassword, _ := auth.HashPassword(user.Password)
-	err = auth.CheckPasswordHash(user.Password, dbUser.HashedPassword)
+	err = config.PasswordHasher.Verify(user.Password, dbUser.HashedPassword)
+	if errors.Is(err, auth.ErrHasherBusy) {
+		// Not a wrong password, so it is not counted as a failure.
+		respondWithHashError(writer, err)
+		return
+	}
 	if err != nil {
-		log.Printf("Invalid email or password")
-		respondWithError(writer, http.StatusUnauthorized, "Invalid email or password")
+		log.Printf("Invalid email or password: %v", err)
+		config.failLogin(writer, request, user.Email, loginUserID, loginWrongPassword, "Invalid email or password")
+		return
+	}
+	config.rehashPassword(dbUser, user.Password)
+	if config.rejectSuspendedLogin(writer, request, dbUser) {
 		return
 	}
 
-	token, err := auth.MakeJWT(dbUser.ID, config.SecretKey, 1*time.Hour)
-	if err != nil {
-		log.Printf("Failed to create JWT: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to create JWT")
+	if dbUser.TotpEnabled {
+		// The failures are only cleared once the second factor is checked
+		// too, so that they also limit guessing codes.
+		config.recordLoginAttempt(request, dbUser.Email, loginUserID, loginTwoFactorRequired)
+		config.respondWithTwoFactorChallenge(writer, dbUser.ID)
 		return
 	}
 
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
-		log.Printf("Failed to create refresh token: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to create refresh token")
+	config.succeedLogin(request, dbUser)
+	config.respondWithLogin(writer, request, dbUser, user.DeviceLabel)
+}
+
+// respondWithHashError answers a failed Hash or Verify call with 503 when
+// too many hashes were already running, and with 500 otherwise.
+func respondWithHashError(writer http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrHasherBusy) {
+		writer.Header().Set("Retry-After", "1")
+		respondWithError(writer, http.StatusServiceUnavailable, "Server busy, try again shortly")
 		return
 	}
+	log.Printf("Failed to hash password: %v", err)
+	respondWithError(writer, http.StatusInternalServerError, "Failed to hash password")
+}
 
-	dbRefreshToken := database.RefreshToken{
-		Token:     refreshToken,
-		UserID:    dbUser.ID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
-		// RevokedAt: time.Time{}, // zero value means not revoked
+// rehashPassword replaces the stored hash of a password that was just
+// verified when it was made with an outdated algorithm or parameters. The
+// login goes on if it fails.
+func (config *APIConfig) rehashPassword(dbUser database.User, password string) {
+	if !config.PasswordHasher.NeedsRehash(dbUser.HashedPassword) {
+		return
+	}
+	hashedPassword, err := config.PasswordHasher.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash password: %v", err)
+		return
 	}
-	_, err = config.Queries.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
-		Token:     dbRefreshToken.Token,
-		UserID:    dbRefreshToken.UserID,
-		CreatedAt: dbRefreshToken.CreatedAt,
-		UpdatedAt: dbRefreshToken.UpdatedAt,
-		ExpiresAt: dbRefreshToken.ExpiresAt,
-		// RevokedAt: time.Time{},
+	// Matching the old hash keeps a concurrent password change from being
+	// overwritten.
+	err = config.Queries.RehashUserPassword(context.Background(), database.RehashUserPasswordParams{
+		NewHash: hashedPassword,
+		ID:      dbUser.ID,
+		OldHash: dbUser.HashedPassword,
 	})
 	if err != nil {
-		log.Printf("Failed to create refresh token in database: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to create refresh token in database")
+		log.Printf("Failed to store rehashed password: %v", err)
+	}
+}
+
+// respondWithLogin signs the user in: it starts a session and responds with
+// the user, an access token and a refresh token.
+func (config *APIConfig) respondWithLogin(writer http.ResponseWriter, request *http.Request, dbUser database.User, deviceLabel string) {
+	roles, err := config.userRoles(dbUser.ID)
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create JWT")
+		return
+	}
+	token, err := config.JWTKeys.MakeJWT(dbUser.ID, roles, 1*time.Hour)
+	if err != nil {
+		log.Printf("Failed to create JWT: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create JWT")
+		return
+	}
+
+	refreshToken, err := config.issueRefreshToken(dbUser.ID, config.newSession(request, deviceLabel))
+	if err != nil {
+		log.Printf("Failed to create refresh token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create refresh token")
 		return
 	}
 
 	respondWithJSON(writer, http.StatusOK, User{
-		ID:           dbUser.ID,
-		CreatedAt:    dbUser.CreatedAt,
-		UpdatedAt:    dbUser.UpdatedAt,
-		Email:        dbUser.Email,
-		Token:        token,
-		RefreshToken: refreshToken,
-		IsChirpyRed:  dbUser.IsChirpyRed,
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		Token:         token,
+		RefreshToken:  refreshToken,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Roles:         roles,
 	})
-
 }
 
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. The presented token is marked as rotated and may not be used
+// again: presenting a rotated token means it was copied, so every token of its
+// family is revoked and the client has to log in again.
 func (config *APIConfig) RefreshToken(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPost {
 		respondWithError(writer, http.StatusBadRequest, "Only POST method is allowed")
@@ -159,40 +231,66 @@ func (config *APIConfig) RefreshToken(writer http.ResponseWriter, request *http.
 		respondWithError(writer, http.StatusUnauthorized, "Invalid or missing token")
 		return
 	}
-	refreshToken, err := config.Queries.GetRefreshToken(context.Background(), token)
-	if err != nil || refreshToken.RevokedAt.Valid {
-		log.Printf("Failed to get refresh token: %v", err)
-		respondWithError(writer, http.StatusUnauthorized, "Failed to get refresh token - Invalid or missing refresh token")
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	tokenHash := auth.HashToken(token)
+	refreshToken, err := queries.RotateRefreshToken(context.Background(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		config.rejectRefreshToken(writer, tokenHash)
 		return
 	}
-	// newRefreshToken, err := auth.MakeRefreshToken()
-	// if err != nil {
-	// 	log.Printf("Failed to create refresh token: %v", err)
-	// 	respondWithError(writer, http.StatusInternalServerError, "Failed to create refresh token")
-	// 	return
-	// }
-	// Update the existing refresh token in the database
-	userUUID, err := config.Queries.GetUserFromRefreshToken(context.Background(), refreshToken.Token)
 	if err != nil {
-		log.Printf("Failed to get user from refresh token: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to get user from refresh token")
+		log.Printf("Failed to rotate refresh token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
 		return
 	}
-	// _, err = config.Queries.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
-	// 	Token:     newRefreshToken,
-	// 	UserID:    userUUID,
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// 	ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
-	// })
-	// if err != nil {
-	// 	log.Printf("Failed to create new refresh token in database: %v", err)
-	// 	respondWithError(writer, http.StatusInternalServerError, "Failed to create new refresh token in database")
-	// 	return
-	// }
-	// *
-	// * the function below was missing and that's what caused the error
-	newAccessToken, err := auth.MakeJWT(userUUID, config.SecretKey, 1*time.Hour)
+
+	suspendedAt, err := queries.GetUserSuspension(context.Background(), refreshToken.UserID)
+	if err != nil {
+		log.Printf("Failed to check account suspension: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	if suspendedAt.Valid {
+		respondWithError(writer, http.StatusForbidden, "Account is suspended")
+		return
+	}
+
+	session := sessionInfo{
+		ID:          refreshToken.SessionID,
+		CreatedAt:   refreshToken.SessionCreatedAt,
+		DeviceLabel: refreshToken.DeviceLabel,
+		UserAgent:   request.UserAgent(),
+		IPAddress:   config.ClientIP(request),
+	}
+	newRefreshToken, err := createRefreshToken(queries, refreshToken.UserID, sql.NullString{String: refreshToken.TokenHash, Valid: true}, session)
+	if err != nil {
+		log.Printf("Failed to create refresh token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Failed to commit refresh token rotation: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	roles, err := config.userRoles(refreshToken.UserID)
+	if err != nil {
+		log.Printf("Failed to load roles: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to create new access token")
+		return
+	}
+	newAccessToken, err := config.JWTKeys.MakeJWT(refreshToken.UserID, roles, 1*time.Hour)
 	if err != nil {
 		log.Printf("Failed to create new access token: %v", err)
 		respondWithError(writer, http.StatusInternalServerError, "Failed to create new access token")
@@ -200,7 +298,30 @@ func (config *APIConfig) RefreshToken(writer http.ResponseWriter, request *http.
 	}
 
 	respondWithJSON(writer, http.StatusOK, map[string]string{
-		"token": newAccessToken})
+		"token":         newAccessToken,
+		"refresh_token": newRefreshToken,
+	})
+}
+
+// rejectRefreshToken answers a refresh with a token that could not be
+// rotated. When the token was already rotated its whole family is revoked.
+func (config *APIConfig) rejectRefreshToken(writer http.ResponseWriter, tokenHash string) {
+	refreshToken, err := config.Queries.GetRefreshToken(context.Background(), tokenHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to get refresh token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+	if err == nil && refreshToken.RotatedAt.Valid {
+		log.Printf("Rotated refresh token reused for user %v, revoking its family", refreshToken.UserID)
+		err = config.Queries.RevokeRefreshTokenFamily(context.Background(), refreshToken.TokenHash)
+		if err != nil {
+			log.Printf("Failed to revoke refresh token family: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to refresh token")
+			return
+		}
+	}
+	respondWithError(writer, http.StatusUnauthorized, "Invalid, expired or revoked refresh token")
 }
 
 func (config *APIConfig) RevokeToken(writer http.ResponseWriter, request *http.Request) {
@@ -223,7 +344,7 @@ func (config *APIConfig) RevokeToken(writer http.ResponseWriter, request *http.R
 	// 	return
 	// }
 
-	err = config.Queries.RevokeRefreshToken(context.Background(), token) // refreshTokenToRevoke.Token)
+	err = config.Queries.RevokeRefreshToken(context.Background(), auth.HashToken(token)) // refreshTokenToRevoke.Token)
 	if err != nil {
 		log.Printf("Failed to revoke refresh token: %v", err)
 		respondWithError(writer, http.StatusInternalServerError, "Failed to revoke refresh token")
@@ -235,67 +356,113 @@ func (config *APIConfig) RevokeToken(writer http.ResponseWriter, request *http.R
 
 }
 
+// UpdateUser applies email and/or password changes to the user identified by
+// the access token. Fields left empty in the request keep their current value.
+// After a password change every other refresh token of the user is revoked and
+// a fresh one is returned so the calling client stays signed in.
 func (config *APIConfig) UpdateUser(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPut {
 		respondWithError(writer, http.StatusMethodNotAllowed, "User update must be a PUT request")
 		return
 	}
 
-	token, err := auth.GetBearerToken(request.Header)
-	if err != nil {
-		respondWithError(writer, http.StatusUnauthorized, "Invalid or missing token")
-		return
-	}
-
-	_, err = auth.ValidateJWT(token, config.SecretKey)
-	if err != nil {
-		log.Printf("Failed to validate JWT: %v", err)
-		respondWithError(writer, http.StatusUnauthorized, "Invalid token")
+	caller, ok := requireScope(writer, request, auth.ScopeProfileWrite)
+	if !ok {
 		return
 	}
+	userID := caller.UserID
 
 	var user User
-	err = json.NewDecoder(request.Body).Decode(&user)
+	err := json.NewDecoder(request.Body).Decode(&user)
 	if err != nil {
 		respondWithError(writer, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	if user.Email == "" {
-		respondWithError(writer, http.StatusBadRequest, "Email is required")
-		return
-	}
-	if user.Password == "" {
-		respondWithError(writer, http.StatusBadRequest, "Password is required")
+	if user.Email == "" && user.Password == "" {
+		respondWithError(writer, http.StatusBadRequest, "Email or password is required")
 		return
 	}
-	user.HashedPassword, err = auth.HashPassword(user.Password)
+
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
 	if err != nil {
-		log.Printf("Failed to hash password: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to hash password")
+		log.Printf("Failed to get user by ID: %v", err)
+		respondWithError(writer, http.StatusUnauthorized, "User does not exist")
 		return
 	}
-	// user.ID = uuid.New()
-	// user.CreatedAt = time.Now()
-	// user.UpdatedAt = user.CreatedAt
 
-	// Save user to the database
-	dbUser, err := config.Queries.CreateUser(context.Background(), database.CreateUserParams{
-		Email:          user.Email,
-		HashedPassword: user.HashedPassword,
-	})
-	if err != nil {
-		log.Printf("Failed to create user: %v", err)
-		respondWithError(writer, http.StatusInternalServerError, "Failed to create user")
-		return
+	params := database.UpdateUserParams{
+		ID:             dbUser.ID,
+		Email:          dbUser.Email,
+		HashedPassword: dbUser.HashedPassword,
 	}
-	// writer.WriteHeader(http.StatusCreated)
-	respondWithJSON(writer, http.StatusOK, User{
-		ID:        dbUser.ID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Email:     dbUser.Email,
-	})
-	log.Printf("User created successfully: %v", dbUser)
+	if user.Email != "" {
+		if validateEmail(user.Email) != nil {
+			respondWithError(writer, http.StatusBadRequest, "Email is not a valid address")
+			return
+		}
+		params.Email = user.Email
+	}
+	if user.Password != "" {
+		if !config.checkPassword(writer, user.Password) {
+			return
+		}
+		params.HashedPassword, err = config.PasswordHasher.Hash(user.Password)
+		if err != nil {
+			respondWithHashError(writer, err)
+			return
+		}
+	}
+
+	previousEmail := dbUser.Email
+	dbUser, err = config.Queries.UpdateUser(context.Background(), params)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(writer, http.StatusConflict, "Email is already in use")
+			return
+		}
+		log.Printf("Failed to update user: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+
+	response := User{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+	}
+
+	// Changing the email clears its verification; the new address has to be
+	// verified again.
+	if dbUser.Email != previousEmail {
+		err = config.sendVerificationEmail(dbUser)
+		if err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+
+	if user.Password != "" {
+		err = config.Queries.RevokeAllRefreshTokensForUser(context.Background(), dbUser.ID)
+		if err != nil {
+			log.Printf("Failed to revoke refresh tokens: %v", err)
+			respondWithError(writer, http.StatusInternalServerError, "Failed to revoke refresh tokens")
+			return
+		}
+		// A personal access token must not be able to start a full session.
+		if !caller.PersonalAccessToken {
+			response.RefreshToken, err = config.issueRefreshToken(dbUser.ID, config.newSession(request, ""))
+			if err != nil {
+				log.Printf("Failed to create refresh token: %v", err)
+				respondWithError(writer, http.StatusInternalServerError, "Failed to create refresh token")
+				return
+			}
+		}
+	}
+
+	respondWithJSON(writer, http.StatusOK, response)
+	log.Printf("User updated successfully: %v", dbUser.ID)
 }
 
 func (config *APIConfig) UpdateChirpyRed(writer http.ResponseWriter, request *http.Request) {
@@ -373,3 +540,38 @@ func (config *APIConfig) UpdateChirpyRed(writer http.ResponseWriter, request *ht
 	writer.WriteHeader(http.StatusNoContent)
 
 }
+
+// issueRefreshToken creates a new refresh token for the user, stores it and
+// returns the value to hand to the client.
+func (config *APIConfig) issueRefreshToken(userID uuid.UUID, session sessionInfo) (string, error) {
+	return createRefreshToken(config.Queries, userID, sql.NullString{}, session)
+}
+
+// createRefreshToken stores the digest of a new refresh token for the user and
+// returns the token itself. A token issued by rotation records the digest of
+// the token it replaces as its parent.
+func createRefreshToken(queries *database.Queries, userID uuid.UUID, parent sql.NullString, session sessionInfo) (string, error) {
+	refreshToken, err := auth.MakeRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = queries.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
+		TokenHash:        auth.HashToken(refreshToken),
+		UserID:           userID,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		ExpiresAt:        now.Add(60 * 24 * time.Hour),
+		ParentTokenHash:  parent,
+		SessionID:        session.ID,
+		SessionCreatedAt: session.CreatedAt,
+		DeviceLabel:      session.DeviceLabel,
+		UserAgent:        session.UserAgent,
+		IpAddress:        session.IPAddress,
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
@@ -1,20 +1,39 @@
 package api
 
 import (
-	"strings"
+	"errors"
+	netmail "net/mail"
+
+	"github.com/jrmts/Chrispy/internal/filter"
+	"github.com/lib/pq"
 )
 
-func badWordReplace(chirp string) string {
-	splitedchirp := strings.Split(chirp, " ")
-	var sliceCleanedChirp []string
-	var cleanedChirp string
-	for _, word := range splitedchirp {
-		if strings.ToLower(word) == "kerfuffle" || strings.ToLower(word) == "sharbert" || strings.ToLower(word) == "fornax" {
-			sliceCleanedChirp = append(sliceCleanedChirp, "****") // "****"
-		} else {
-			sliceCleanedChirp = append(sliceCleanedChirp, word)
-		}
+const maxChirpLength = 140
+
+var errChirpTooLong = errors.New("chirp is too long")
+
+// checkChirpBody checks a chirp body against the length limit and runs it
+// through the content filter. Both creating and editing a chirp go through it.
+func (config *APIConfig) checkChirpBody(body string) (filter.Result, error) {
+	if len(body) > maxChirpLength {
+		return filter.Result{}, errChirpTooLong
+	}
+	return config.ContentFilter.Apply(body), nil
+}
+
+// validateEmail checks that email is a bare address such as
+// "walt@example.com", without a display name or comments.
+func validateEmail(email string) error {
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return errors.New("invalid email address")
 	}
-	cleanedChirp = strings.Join(sliceCleanedChirp, " ")
-	return cleanedChirp
+	return nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation, e.g. an email that is already taken.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
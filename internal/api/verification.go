@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/jrmts/Chrispy/internal/auth"
+	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/mail"
+)
+
+// sendVerificationEmail mails the user a token, valid for a day, proving they
+// own their current email address. Earlier tokens stop working.
+func (config *APIConfig) sendVerificationEmail(dbUser database.User) error {
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := config.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	queries := config.Queries.WithTx(tx)
+
+	err = queries.DeleteEmailVerificationTokens(context.Background(), dbUser.ID)
+	if err != nil {
+		return err
+	}
+	err = queries.CreateEmailVerificationToken(context.Background(), database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    dbUser.ID,
+		Email:     dbUser.Email,
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	go config.sendMail(mail.Message{
+		To:      dbUser.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+			"To verify your email address, open GET /api/users/verify?token=%s within a day.\n\n"+
+			"If you did not sign up, ignore this email.\n", token),
+	})
+	return nil
+}
+
+// VerifyEmail marks the email address a verification token was sent to as
+// verified. The token stops working once used, and when the user has changed
+// their email since it was sent.
+func (config *APIConfig) VerifyEmail(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Verification must be a GET request")
+		return
+	}
+
+	token := request.URL.Query().Get("token")
+	if token == "" {
+		respondWithError(writer, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	row, err := config.Queries.UseEmailVerificationToken(context.Background(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(writer, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to use verification token: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	verified, err := config.Queries.VerifyUserEmail(context.Background(), database.VerifyUserEmailParams{
+		ID:    row.UserID,
+		Email: row.Email,
+	})
+	if err != nil {
+		log.Printf("Failed to verify email: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+	if verified == 0 {
+		respondWithError(writer, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationEmail sends the caller a new verification email. It
+// answers 429 when the last one went out less than five minutes ago.
+func (config *APIConfig) ResendVerificationEmail(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		respondWithError(writer, http.StatusMethodNotAllowed, "Verification must be a POST request")
+		return
+	}
+
+	userID, ok := requireLogin(writer, request)
+	if !ok {
+		return
+	}
+
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user by ID: %v", err)
+		respondWithError(writer, http.StatusUnauthorized, "User does not exist")
+		return
+	}
+	if dbUser.EmailVerifiedAt.Valid {
+		respondWithError(writer, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	// The database computes the wait, since its clock wrote created_at.
+	waitSeconds, err := config.Queries.GetEmailVerificationCooldown(context.Background(), dbUser.ID)
+	if err != nil {
+		log.Printf("Failed to get verification email cooldown: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	if waitSeconds > 0 {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(waitSeconds)))
+		respondWithError(writer, http.StatusTooManyRequests, "A verification email was sent recently, try again later")
+		return
+	}
+
+	err = config.sendVerificationEmail(dbUser)
+	if err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+		respondWithError(writer, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// requireVerifiedEmail enforces RequireVerifiedEmail for a user about to post.
+// When it returns false an error response has already been written.
+func (config *APIConfig) requireVerifiedEmail(writer http.ResponseWriter, userID uuid.UUID) bool {
+	if !config.RequireVerifiedEmail {
+		return true
+	}
+	dbUser, err := config.Queries.GetUserById(context.Background(), userID)
+	if err != nil {
+		log.Printf("Failed to get user by ID: %v", err)
+		respondWithError(writer, http.StatusUnauthorized, "User does not exist")
+		return false
+	}
+	if !dbUser.EmailVerifiedAt.Valid {
+		respondWithError(writer, http.StatusForbidden, "Verify your email address before posting")
+		return false
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -10,28 +11,42 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// HashPassword hashes a password with DefaultPasswordHasher.
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
+	return DefaultPasswordHasher.Hash(password)
 }
 
+// CheckPasswordHash checks a password against an argon2id or bcrypt hash.
 func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return DefaultPasswordHasher.Verify(password, hash)
+}
+
+// challengeTokenIssuer is the issuer of two-factor challenge tokens. They are
+// only ever checked by this server, so they are signed with the shared secret
+// rather than the access token keys.
+const challengeTokenIssuer = "chirpy-2fa"
+
+// MakeChallengeJWT returns a token proving that a user passed the password
+// step of a two-factor login. It is signed with HS256, so it is not accepted
+// where an access token is expected.
+func MakeChallengeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return makeJWT(userID, tokenSecret, expiresIn, challengeTokenIssuer)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// ValidateChallengeJWT validates a token made by MakeChallengeJWT.
+func ValidateChallengeJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return validateJWT(tokenString, tokenSecret, challengeTokenIssuer)
+}
+
+func makeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, issuer string) (string, error) {
 	// Define the claims for the JWT
 	claims := jwt.RegisteredClaims{
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "chirpy",
+		Issuer:    issuer,
 		Subject:   userID.String(),
 	}
 
@@ -44,7 +59,7 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func validateJWT(tokenString, tokenSecret, issuer string) (uuid.UUID, error) {
 	claims := &jwt.RegisteredClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -52,7 +67,7 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 			return nil, jwt.ErrSignatureInvalid
 		}
 		return []byte(tokenSecret), nil
-	}, jwt.WithLeeway(5*time.Second), jwt.WithIssuer("chirpy"))
+	}, jwt.WithLeeway(5*time.Second), jwt.WithIssuer(issuer))
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -96,11 +111,23 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return bearer, nil
 }
 
-func MakeRefreshToken() (string, error) {
+// MakeRandomToken returns 32 random bytes in hex, for refresh tokens and for
+// the one-time tokens sent by email, such as password reset tokens.
+func MakeRandomToken() (string, error) {
 	token := make([]byte, 32)
-	rand.Read(token)
-	tokenHexString := hex.EncodeToString(token)
-	return tokenHexString, nil
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// HashToken returns the hex SHA-256 digest of a refresh, personal access or
+// one-time token. Only the digest is stored, so the tokens cannot be read back
+// from the database. The tokens are random, so an unsalted fast hash is enough.
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
 }
 
 func GetAPIKey(headers http.Header) (string, error) {
@@ -1,11 +1,21 @@
 package auth_test
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jrmts/Chrispy/internal/auth"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestCheckPasswordHash(t *testing.T) {
@@ -63,35 +73,81 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func newKeySet(t *testing.T, audience string, signer crypto.Signer, verificationKeys ...crypto.PublicKey) *auth.KeySet {
+	t.Helper()
+	keySet, err := auth.NewKeySet("chirpy", audience, signer, verificationKeys...)
+	if err != nil {
+		t.Fatalf("NewKeySet() error = %v", err)
+	}
+	return keySet
+}
+
 func TestValidateJWT(t *testing.T) {
+	_, currentKey, _ := ed25519.GenerateKey(nil)
+	retiredKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, unknownKey, _ := ed25519.GenerateKey(nil)
+
+	keySet := newKeySet(t, "chirpy", currentKey, retiredKey.Public())
+	retiredKeySet := newKeySet(t, "chirpy", retiredKey)
+	unknownKeySet := newKeySet(t, "chirpy", unknownKey)
+	otherAudienceKeySet := newKeySet(t, "other", currentKey)
+
 	userID := uuid.New()
-	validToken, _ := auth.MakeJWT(userID, "secret", time.Hour)
+	roles := []string{"user", "moderator"}
+	validToken, _ := keySet.MakeJWT(userID, roles, time.Hour)
+	retiredKeyToken, _ := retiredKeySet.MakeJWT(userID, nil, time.Hour)
+	unknownKeyToken, _ := unknownKeySet.MakeJWT(userID, nil, time.Hour)
+	otherAudienceToken, _ := otherAudienceKeySet.MakeJWT(userID, nil, time.Hour)
+	expiredToken, _ := keySet.MakeJWT(userID, nil, -time.Hour)
+	challengeToken, _ := auth.MakeChallengeJWT(userID, "secret", time.Hour)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
 		wantUserID  uuid.UUID
+		wantRoles   []string
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			wantUserID:  userID,
+			wantRoles:   roles,
+			wantErr:     false,
+		},
+		{
+			name:        "Token signed with a retired RSA key",
+			tokenString: retiredKeyToken,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
-			name:        "Wrong secret",
-			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			name:        "Unknown key",
+			tokenString: unknownKeyToken,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Wrong audience",
+			tokenString: otherAudienceToken,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Two-factor challenge token",
+			tokenString: challengeToken,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -99,7 +155,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := auth.ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, gotRoles, err := keySet.ValidateJWT(tt.tokenString)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -107,6 +163,284 @@ func TestValidateJWT(t *testing.T) {
 			if gotUserID != tt.wantUserID {
 				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
 			}
+			if !slices.Equal(gotRoles, tt.wantRoles) {
+				t.Errorf("ValidateJWT() gotRoles = %v, want %v", gotRoles, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	_, currentKey, _ := ed25519.GenerateKey(nil)
+	retiredKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keySet := newKeySet(t, "chirpy", currentKey, retiredKey.Public())
+
+	jwks := keySet.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks.Keys))
+	}
+	algs := map[string]string{}
+	for _, key := range jwks.Keys {
+		algs[key.Kty] = key.Alg
+	}
+	if algs["OKP"] != "EdDSA" || algs["RSA"] != "RS256" {
+		t.Errorf("JWKS() algorithms = %v, want EdDSA and RS256", algs)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := auth.MakeRandomToken()
+	if err != nil {
+		t.Fatalf("MakeRandomToken() error = %v", err)
+	}
+	other, err := auth.MakeRandomToken()
+	if err != nil {
+		t.Fatalf("MakeRandomToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		other     string
+		wantEqual bool
+	}{
+		{
+			name:      "Same token",
+			token:     token,
+			other:     token,
+			wantEqual: true,
+		},
+		{
+			name:      "Different tokens",
+			token:     token,
+			other:     other,
+			wantEqual: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := auth.HashToken(tt.token)
+			if hash == tt.token {
+				t.Errorf("HashToken() returned the token unchanged")
+			}
+			if got := hash == auth.HashToken(tt.other); got != tt.wantEqual {
+				t.Errorf("HashToken() equal = %v, want %v", got, tt.wantEqual)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "Known scopes",
+			requested: []string{"chirps:write", "chirps:read"},
+			want:      []string{"chirps:write", "chirps:read"},
+		},
+		{
+			name:      "Duplicates",
+			requested: []string{"chirps:write", "chirps:write"},
+			want:      []string{"chirps:write"},
+		},
+		{
+			name:      "Unknown scope",
+			requested: []string{"chirps:write", "admin"},
+			wantErr:   true,
+		},
+		{
+			name:      "No scopes",
+			requested: nil,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.ParseScopes(tt.requested)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	listFile := filepath.Join(dir, "pwned.txt")
+	err := os.WriteFile(listFile, []byte("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rangeDir := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(rangeDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(rangeDir, "5BAA6"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{listFile, rangeDir} {
+		breached, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			t.Fatalf("LoadBreachedPasswords(%q) error = %v", path, err)
+		}
+		policy := auth.DefaultPasswordPolicy
+		policy.Breached = breached
+
+		tests := []struct {
+			name      string
+			password  string
+			wantRules []string
+		}{
+			{name: "Strong password", password: "correct-Horse-battery-9"},
+			{name: "Too short", password: "x7#Qe", wantRules: []string{auth.RuleMinLength, auth.RuleEntropy}},
+			{name: "Repeated characters", password: "aaaaaaaaaaaa", wantRules: []string{auth.RuleEntropy}},
+			{name: "Sequence", password: "abcdefghijkl", wantRules: []string{auth.RuleEntropy}},
+			{name: "Breached", password: "password", wantRules: []string{auth.RuleEntropy, auth.RuleBreached}},
+			{name: "Too long", password: strings.Repeat("Tr0ub4dor&3", 24), wantRules: []string{auth.RuleMaxLength}},
+		}
+
+		for _, tt := range tests {
+			t.Run(filepath.Base(path)+"/"+tt.name, func(t *testing.T) {
+				violations, err := policy.Check(tt.password)
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				var rules []string
+				for _, violation := range violations {
+					rules = append(rules, violation.Rule)
+				}
+				if !slices.Equal(rules, tt.wantRules) {
+					t.Errorf("Check(%q) rules = %v, want %v", tt.password, rules, tt.wantRules)
+				}
+			})
+		}
+	}
+}
+
+func TestArgon2idHasher(t *testing.T) {
+	params := auth.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hasher := &auth.Argon2idHasher{Params: params}
+	hash, err := hasher.Hash("correctPassword123!")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want an argon2id PHC string", hash)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := params
+	stronger.Memory = 2048
+	tests := []struct {
+		name            string
+		hasher          *auth.Argon2idHasher
+		password        string
+		hash            string
+		wantErr         error
+		wantNeedsRehash bool
+	}{
+		{name: "Argon2id match", hasher: hasher, password: "correctPassword123!", hash: hash},
+		{name: "Argon2id mismatch", hasher: hasher, password: "wrongPassword", hash: hash, wantErr: auth.ErrPasswordMismatch},
+		{name: "Bcrypt match", hasher: hasher, password: "correctPassword123!", hash: string(bcryptHash), wantNeedsRehash: true},
+		{name: "Bcrypt mismatch", hasher: hasher, password: "wrongPassword", hash: string(bcryptHash), wantErr: auth.ErrPasswordMismatch, wantNeedsRehash: true},
+		{name: "Outdated parameters", hasher: &auth.Argon2idHasher{Params: stronger}, password: "correctPassword123!", hash: hash, wantNeedsRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hasher.Verify(tt.password, tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.wantNeedsRehash {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.wantNeedsRehash)
+			}
+		})
+	}
+
+	if err := hasher.Verify("correctPassword123!", "$argon2id$v=19$m=1024$bad"); err == nil || errors.Is(err, auth.ErrPasswordMismatch) {
+		t.Errorf("Verify() of a malformed hash error = %v, want a parse error", err)
+	}
+}
+
+// blockingHasher holds every Hash call until release is closed.
+type blockingHasher struct {
+	auth.PasswordHasher
+	started chan struct{}
+	release chan struct{}
+}
+
+func (hasher blockingHasher) Hash(password string) (string, error) {
+	hasher.started <- struct{}{}
+	<-hasher.release
+	return "hash", nil
+}
+
+func TestLimitedHasher(t *testing.T) {
+	inner := blockingHasher{started: make(chan struct{}), release: make(chan struct{})}
+	hasher := auth.NewLimitedHasher(inner, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := hasher.Hash("first")
+		done <- err
+	}()
+	<-inner.started
+
+	if _, err := hasher.Hash("second"); !errors.Is(err, auth.ErrHasherBusy) {
+		t.Errorf("Hash() while full error = %v, want ErrHasherBusy", err)
+	}
+	if err := hasher.Verify("second", "hash"); !errors.Is(err, auth.ErrHasherBusy) {
+		t.Errorf("Verify() while full error = %v, want ErrHasherBusy", err)
+	}
+
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatalf("first Hash() error = %v", err)
+	}
+	go func() { <-inner.started }()
+	if _, err := hasher.Hash("third"); err != nil {
+		t.Errorf("Hash() after release error = %v", err)
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      []string
+		permission auth.Permission
+		want       bool
+	}{
+		{name: "No roles", roles: nil, permission: auth.PermissionDeleteAnyChirp, want: false},
+		{name: "User", roles: []string{"user"}, permission: auth.PermissionDeleteAnyChirp, want: false},
+		{name: "Moderator deletes chirps", roles: []string{"user", "moderator"}, permission: auth.PermissionDeleteAnyChirp, want: true},
+		{name: "Moderator manages users", roles: []string{"user", "moderator"}, permission: auth.PermissionManageUsers, want: false},
+		{name: "Admin deletes chirps", roles: []string{"user", "admin"}, permission: auth.PermissionDeleteAnyChirp, want: true},
+		{name: "Admin manages users", roles: []string{"user", "admin"}, permission: auth.PermissionManageUsers, want: true},
+		{name: "Unknown role", roles: []string{"owner"}, permission: auth.PermissionManageUsers, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auth.HasPermission(tt.roles, tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%v, %s) = %v, want %v", tt.roles, tt.permission, got, tt.want)
+			}
 		})
 	}
 }
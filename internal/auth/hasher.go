@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password does not match its hash.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHasher hashes passwords with one scheme and verifies hashes made
+// with any scheme it supports. Hashes are self-describing strings that carry
+// their algorithm, version and parameters, so the scheme can change without
+// invalidating stored passwords.
+type PasswordHasher interface {
+	// Hash returns the hash of a new password.
+	Hash(password string) (string, error)
+	// Verify returns nil if password matches hash, and ErrPasswordMismatch
+	// if it does not.
+	Verify(password, hash string) error
+	// NeedsRehash reports whether hash was made with another algorithm, or
+	// weaker parameters, than Hash uses now. Such a hash should be replaced
+	// the next time the password is known.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idParams are the cost parameters of argon2id (RFC 9106).
+type Argon2idParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the second recommended option of RFC 9106:
+// 64 MiB of memory and three passes.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with argon2id in the PHC string format,
+// e.g. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>". It still verifies the
+// bcrypt hashes stored before argon2id was introduced, and reports them as
+// needing a rehash.
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+// DefaultPasswordHasher hashes with DefaultArgon2idParams.
+var DefaultPasswordHasher PasswordHasher = &Argon2idHasher{Params: DefaultArgon2idParams}
+
+const argon2idPrefix = "$argon2id$"
+
+func (hasher *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	params := hasher.Params
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (hasher *Argon2idHasher) Verify(password, hash string) error {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (hasher *Argon2idHasher) NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+	params, salt, _, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	current := hasher.Params
+	return params.Memory < current.Memory ||
+		params.Iterations < current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.KeyLength < current.KeyLength ||
+		uint32(len(salt)) < current.SaltLength
+}
+
+// parseArgon2id splits a PHC string into its parameters, salt and key.
+func parseArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2idParams{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	var params Argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// ErrHasherBusy is returned by a LimitedHasher that is already running as
+// many hashes as it may.
+var ErrHasherBusy = errors.New("too many password hashes in progress")
+
+// LimitedHasher bounds how many hashes of another PasswordHasher run at once,
+// so that a burst of logins cannot exhaust the memory argon2id needs. When
+// every slot is taken, Hash and Verify fail right away with ErrHasherBusy
+// rather than queuing.
+type LimitedHasher struct {
+	PasswordHasher
+	slots chan struct{}
+}
+
+// NewLimitedHasher lets at most maxConcurrent hashes of hasher run at once.
+func NewLimitedHasher(hasher PasswordHasher, maxConcurrent int) *LimitedHasher {
+	return &LimitedHasher{PasswordHasher: hasher, slots: make(chan struct{}, max(maxConcurrent, 1))}
+}
+
+func (hasher *LimitedHasher) Hash(password string) (string, error) {
+	if !hasher.acquire() {
+		return "", ErrHasherBusy
+	}
+	defer hasher.release()
+	return hasher.PasswordHasher.Hash(password)
+}
+
+func (hasher *LimitedHasher) Verify(password, hash string) error {
+	if !hasher.acquire() {
+		return ErrHasherBusy
+	}
+	defer hasher.release()
+	return hasher.PasswordHasher.Verify(password, hash)
+}
+
+func (hasher *LimitedHasher) acquire() bool {
+	select {
+	case hasher.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (hasher *LimitedHasher) release() {
+	<-hasher.slots
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const minRSAKeyBits = 2048
+
+// KeySet signs access tokens with one private key and verifies them with any
+// of its public keys. To rotate keys, sign with the new key while the old
+// public key stays in the set until the tokens it signed have expired.
+// Ed25519 keys sign with EdDSA and RSA keys with RS256.
+type KeySet struct {
+	Issuer   string
+	Audience string
+
+	signingKeyID string
+	signer       crypto.Signer
+	keys         map[string]crypto.PublicKey
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeySet returns a key set signing with signer. The public key of signer
+// is always accepted; verificationKeys are accepted as well.
+func NewKeySet(issuer, audience string, signer crypto.Signer, verificationKeys ...crypto.PublicKey) (*KeySet, error) {
+	signingKeyID, err := KeyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	keySet := &KeySet{
+		Issuer:       issuer,
+		Audience:     audience,
+		signingKeyID: signingKeyID,
+		signer:       signer,
+		keys:         map[string]crypto.PublicKey{signingKeyID: signer.Public()},
+	}
+	for _, key := range verificationKeys {
+		kid, err := KeyID(key)
+		if err != nil {
+			return nil, err
+		}
+		keySet.keys[kid] = key
+	}
+	return keySet, nil
+}
+
+// accessClaims are the claims of an access token: the registered claims and
+// the roles of the user when the token was issued.
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// MakeJWT returns an access token for the user, carrying their roles.
+func (keySet *KeySet) MakeJWT(userID uuid.UUID, roles []string, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	claims := accessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    keySet.Issuer,
+			Audience:  jwt.ClaimStrings{keySet.Audience},
+			Subject:   userID.String(),
+		},
+		Roles: roles,
+	}
+
+	method, err := signingMethod(keySet.signer.Public())
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = keySet.signingKeyID
+	return token.SignedString(keySet.signer)
+}
+
+// ValidateJWT checks an access token and returns the ID of the user it was
+// issued to, and their roles at the time.
+func (keySet *KeySet) ValidateJWT(tokenString string) (uuid.UUID, []string, error) {
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keySet.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		method, err := signingMethod(key)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithLeeway(5*time.Second),
+		jwt.WithIssuer(keySet.Issuer),
+		jwt.WithAudience(keySet.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("invalid user ID in token: %w", err)
+	}
+	return userID, claims.Roles, nil
+}
+
+// JWKS returns the public keys of the set, ordered by key ID.
+func (keySet *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(keySet.keys))}
+	for kid, key := range keySet.keys {
+		jwk, _ := publicJWK(key)
+		jwk.Kid = kid
+		jwk.Use = "sig"
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+// KeyID returns the RFC 7638 thumbprint of a public key, used as its "kid".
+func KeyID(key crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	// The thumbprint hashes the required members in lexicographic order,
+	// which is the order encoding/json writes map keys in.
+	members := map[string]string{"kty": jwk.Kty}
+	switch jwk.Kty {
+	case "OKP":
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+	case "RSA":
+		members["e"] = jwk.E
+		members["n"] = jwk.N
+	}
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+func publicJWK(key crypto.PublicKey) (JWK, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Alg: jwt.SigningMethodEdDSA.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func signingMethod(key crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		return jwt.SigningMethodRS256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// LoadSigningKey reads an Ed25519 or RSA private key from a PEM file.
+func LoadSigningKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	_, err = signingMethod(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// LoadVerificationKey reads an Ed25519 or RSA public key from a PEM file.
+func LoadVerificationKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	_, err = signingMethod(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password policy rules, as reported in PasswordViolation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleEntropy   = "entropy"
+	RuleBreached  = "breached"
+)
+
+// maxPasswordBytes bounds the length of a password. No real password is
+// longer, and megabyte passwords would only be a way to waste server time.
+const maxPasswordBytes = 256
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MinEntropyBits is the minimum strength as scored by PasswordEntropy.
+	MinEntropyBits float64
+	// Breached lists known leaked passwords. When it is nil the check is
+	// skipped.
+	Breached *BreachedPasswords
+}
+
+// DefaultPasswordPolicy requires eight characters and rejects the weakest
+// patterns, such as "aaaaaaaa" or "password".
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MinEntropyBits: 35,
+}
+
+// PasswordViolation explains why a password was rejected.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Check returns every rule of the policy the password breaks. An error means
+// the breached password list could not be read.
+func (policy PasswordPolicy) Check(password string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+	if length := utf8.RuneCountInString(password); length < policy.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", policy.MinLength),
+		})
+	}
+	if len(password) > maxPasswordBytes {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", maxPasswordBytes),
+		})
+	}
+	if PasswordEntropy(password) < policy.MinEntropyBits {
+		violations = append(violations, PasswordViolation{
+			Rule:    RuleEntropy,
+			Message: "Password is too easy to guess; use a longer password with fewer repeated or sequential characters",
+		})
+	}
+	if policy.Breached != nil {
+		breached, err := policy.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Rule:    RuleBreached,
+				Message: "Password appears in a list of leaked passwords",
+			})
+		}
+	}
+	return violations, nil
+}
+
+// PasswordEntropy estimates the strength of a password in bits. Each
+// character is worth log2 of the size of the character classes the password
+// draws from, except that characters repeating or continuing a sequence from
+// the previous one ("aa", "ab", "21") are worth a single bit, and characters
+// used earlier are worth half.
+func PasswordEntropy(password string) float64 {
+	pool := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(pool))
+	var bits float64
+	seen := make(map[rune]bool)
+	previous := rune(-1)
+	for _, r := range password {
+		folded := unicode.ToLower(r)
+		switch {
+		case previous >= 0 && (folded == previous || folded == previous+1 || folded == previous-1):
+			bits++
+		case seen[folded]:
+			bits += bitsPerChar / 2
+		default:
+			bits += bitsPerChar
+		}
+		seen[folded] = true
+		previous = folded
+	}
+	return bits
+}
+
+// BreachedPasswords is a local copy of leaked password hashes in the format
+// of the Pwned Passwords list: upper case SHA-1 digests in hex, each
+// optionally followed by ":count". No network access is needed to check it.
+type BreachedPasswords struct {
+	// dir holds one file per 5-character hash prefix, named after the
+	// prefix, listing the 35-character suffixes in that range. This is the
+	// k-anonymity layout of the range API and its downloaders.
+	dir string
+	// hashes is a whole list loaded from a single file.
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// hashPrefixLength is the length of the prefix that names range files.
+const hashPrefixLength = 5
+
+// LoadBreachedPasswords opens a breached password list. If path is a
+// directory it is read as range files, one lookup at a time; otherwise the
+// file is loaded into memory, one full hash per line.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	list := &BreachedPasswords{hashes: make(map[[sha1.Size]byte]struct{})}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		digest, ok := parseHashLine(line)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash", path, lineNumber)
+		}
+		var key [sha1.Size]byte
+		copy(key[:], digest)
+		list.hashes[key] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return list, nil
+}
+
+// Contains reports whether the password is in the list.
+func (list *BreachedPasswords) Contains(password string) (bool, error) {
+	digest := sha1.Sum([]byte(password))
+	if list.hashes != nil {
+		_, ok := list.hashes[digest]
+		return ok, nil
+	}
+
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+	file, err := os.Open(filepath.Join(list.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(filepath.Join(list.dir, prefix+".txt"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password range: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password range: %w", err)
+	}
+	return false, nil
+}
+
+func parseHashLine(line string) ([]byte, bool) {
+	hash, _, _ := strings.Cut(line, ":")
+	digest, err := hex.DecodeString(hash)
+	if err != nil || len(digest) != sha1.Size {
+		return nil, false
+	}
+	return digest, true
+}
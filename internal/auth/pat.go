@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells
+// them apart from JWTs and makes leaked tokens easy to search for.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// Scope is a permission granted to a personal access token.
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// MakePersonalAccessToken returns a new random personal access token.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRandomToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// ParseScopes checks requested scopes and returns them without duplicates.
+func ParseScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	var scopes []string
+	for _, scope := range requested {
+		if !slices.Contains(Scopes, Scope(scope)) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether granted includes scope.
+func HasScope(granted []string, scope Scope) bool {
+	return slices.Contains(granted, string(scope))
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role is a set of permissions granted to a user.
+type Role string
+
+const (
+	// RoleUser is held by every account.
+	RoleUser Role = "user"
+	// RoleModerator can remove other people's content.
+	RoleModerator Role = "moderator"
+	// RoleAdmin can do everything.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role, from least to most privileged.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// Permission is something a role allows.
+type Permission string
+
+const (
+	PermissionDeleteAnyChirp Permission = "chirps:delete_any"
+	PermissionReviewContent  Permission = "content:review"
+	PermissionManageFilter   Permission = "filter:manage"
+	PermissionManageUsers    Permission = "users:manage"
+	PermissionViewMetrics    Permission = "metrics:read"
+	PermissionResetData      Permission = "data:reset"
+)
+
+var moderatorPermissions = []Permission{
+	PermissionDeleteAnyChirp,
+	PermissionReviewContent,
+}
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      nil,
+	RoleModerator: moderatorPermissions,
+	RoleAdmin: append(slices.Clone(moderatorPermissions),
+		PermissionManageFilter,
+		PermissionManageUsers,
+		PermissionViewMetrics,
+		PermissionResetData,
+	),
+}
+
+// ParseRole validates a role name.
+func ParseRole(name string) (Role, error) {
+	if _, ok := rolePermissions[Role(name)]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected user, moderator or admin", name)
+	}
+	return Role(name), nil
+}
+
+// HasPermission reports whether any of the roles allows permission.
+func HasPermission(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[Role(role)], permission) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,29 +7,79 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countRepliesForChirps = `-- name: CountRepliesForChirps :many
+SELECT in_reply_to::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE in_reply_to = ANY($1::uuid[])
+GROUP BY in_reply_to
+`
+
+type CountRepliesForChirpsRow struct {
+	ChirpID    uuid.UUID
+	ReplyCount int64
+}
+
+func (q *Queries) CountRepliesForChirps(ctx context.Context, chirpIds []uuid.UUID) ([]CountRepliesForChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countRepliesForChirps, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountRepliesForChirpsRow
+	for rows.Next() {
+		var i CountRepliesForChirpsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, user_id, body, created_at, updated_at
+RETURNING id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.QuoteOf,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +87,47 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.Body,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2
+)
+RETURNING id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -59,12 +150,20 @@ func (q *Queries) DeleteOneChirps(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
-const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, user_id, body, created_at, updated_at FROM chirps ORDER BY created_at ASC
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, in_reply_to) AS (
+    SELECT c.id, c.in_reply_to FROM chirps c WHERE c.id = $1
+    UNION ALL
+    SELECT c.id, c.in_reply_to FROM chirps c JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps
+WHERE chirps.id IN (SELECT ancestors.id FROM ancestors) AND chirps.id <> $1
+  AND chirps.hidden_at IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +177,11 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.Body,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -92,12 +196,56 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpByAuthorID = `-- name: GetChirpByAuthorID :many
-SELECT id, user_id, body, created_at, updated_at FROM chirps WHERE user_id = $1
+const getChirpByID = `-- name: GetChirpByID :one
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps WHERE id = $1
+`
+
+func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const getChirpByIDForUpdate = `-- name: GetChirpByIDForUpdate :one
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps WHERE id = $1 FOR UPDATE
 `
 
-func (q *Queries) GetChirpByAuthorID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpByAuthorID, userID)
+func (q *Queries) GetChirpByIDForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +259,11 @@ func (q *Queries) GetChirpByAuthorID(ctx context.Context, userID uuid.UUID) ([]C
 			&i.Body,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -125,12 +278,275 @@ func (q *Queries) GetChirpByAuthorID(ctx context.Context, userID uuid.UUID) ([]C
 	return items, nil
 }
 
-const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, user_id, body, created_at, updated_at FROM chirps WHERE id = $1
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c WHERE c.in_reply_to = $1
+    UNION ALL
+    SELECT c.id FROM chirps c JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps
+WHERE chirps.id IN (SELECT descendants.id FROM descendants)
+  AND chirps.hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+       OR (chirps.created_at, chirps.id) > ($2::timestamp, $3::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $4
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+type ListChirpDescendantsParams struct {
+	RootID         uuid.UUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants,
+		arg.RootID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+  AND hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+       OR (created_at, id) > ($2::timestamp, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListChirpsAscParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+  AND hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+       OR (created_at, id) < ($2::timestamp, $3::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListChirpsDescParams struct {
+	AuthorID       uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.user_id, chirps.body, chirps.created_at, chirps.updated_at, chirps.search_vector, chirps.in_reply_to, chirps.rechirp_of, chirps.quote_of, chirps.hidden_at, ts_rank(chirps.search_vector, tsq)::real AS rank
+FROM chirps, websearch_to_tsquery('english', $1) AS tsq
+WHERE chirps.search_vector @@ tsq
+  AND chirps.hidden_at IS NULL
+  AND ($2::uuid IS NULL OR chirps.user_id = $2)
+  AND ($3::timestamp IS NULL OR chirps.created_at >= $3)
+  AND ($4::timestamp IS NULL OR chirps.created_at < $4)
+  AND ($5::real IS NULL
+       OR (ts_rank(chirps.search_vector, tsq), chirps.created_at, chirps.id)
+          < ($5::real, $6::timestamp, $7::uuid))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $8
+`
+
+type SearchChirpsParams struct {
+	Search         string
+	AuthorID       uuid.NullUUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterRank      sql.NullFloat64
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	Limit          int32
+}
+
+type SearchChirpsRow struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Body         string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	HiddenAt     sql.NullTime
+	Rank         float32
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Search,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.AfterRank,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.HiddenAt,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $1, updated_at = NOW() WHERE id = $2
+RETURNING id, user_id, body, created_at, updated_at, search_vector, in_reply_to, rechirp_of, quote_of, hidden_at
+`
+
+type UpdateChirpBodyParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -138,6 +554,11 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.Body,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -7,79 +7,228 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, user_id, created_at, updated_at, expires_at)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING token, user_id, created_at, updated_at, expires_at, revoked_at
+INSERT INTO refresh_tokens (
+    token_hash, user_id, created_at, updated_at, expires_at, parent_token_hash,
+    session_id, session_created_at, device_label, user_agent, ip_address
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING token_hash, user_id, created_at, updated_at, expires_at, revoked_at, parent_token_hash, rotated_at, session_id, session_created_at, device_label, user_agent, ip_address
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	UserID    uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	ExpiresAt time.Time
+	TokenHash        string
+	UserID           uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	ExpiresAt        time.Time
+	ParentTokenHash  sql.NullString
+	SessionID        uuid.UUID
+	SessionCreatedAt time.Time
+	DeviceLabel      string
+	UserAgent        string
+	IpAddress        string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
 	row := q.db.QueryRowContext(ctx, createRefreshToken,
-		arg.Token,
+		arg.TokenHash,
 		arg.UserID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.ExpiresAt,
+		arg.ParentTokenHash,
+		arg.SessionID,
+		arg.SessionCreatedAt,
+		arg.DeviceLabel,
+		arg.UserAgent,
+		arg.IpAddress,
 	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ParentTokenHash,
+		&i.RotatedAt,
+		&i.SessionID,
+		&i.SessionCreatedAt,
+		&i.DeviceLabel,
+		&i.UserAgent,
+		&i.IpAddress,
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, user_id, created_at, updated_at, expires_at, revoked_at FROM refresh_tokens WHERE token = $1
+SELECT token_hash, user_id, created_at, updated_at, expires_at, revoked_at, parent_token_hash, rotated_at, session_id, session_created_at, device_label, user_agent, ip_address FROM refresh_tokens WHERE token_hash = $1
 `
 
-func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshToken, token)
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.ParentTokenHash,
+		&i.RotatedAt,
+		&i.SessionID,
+		&i.SessionCreatedAt,
+		&i.DeviceLabel,
+		&i.UserAgent,
+		&i.IpAddress,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT user_id FROM refresh_tokens WHERE token = $1
+SELECT user_id FROM refresh_tokens WHERE token_hash = $1
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var user_id uuid.UUID
 	err := row.Scan(&user_id)
 	return user_id, err
 }
 
+const listSessions = `-- name: ListSessions :many
+SELECT token_hash, user_id, created_at, updated_at, expires_at, revoked_at, parent_token_hash, rotated_at, session_id, session_created_at, device_label, user_agent, ip_address FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListSessions(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.TokenHash,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ParentTokenHash,
+			&i.RotatedAt,
+			&i.SessionID,
+			&i.SessionCreatedAt,
+			&i.DeviceLabel,
+			&i.UserAgent,
+			&i.IpAddress,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
-UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token_hash = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
 	return err
 }
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+WITH RECURSIVE ancestors AS (
+    SELECT token_hash, parent_token_hash FROM refresh_tokens WHERE token_hash = $1
+    UNION ALL
+    SELECT r.token_hash, r.parent_token_hash FROM refresh_tokens r
+    JOIN ancestors a ON r.token_hash = a.parent_token_hash
+), family AS (
+    SELECT token_hash FROM ancestors WHERE parent_token_hash IS NULL
+    UNION ALL
+    SELECT r.token_hash FROM refresh_tokens r
+    JOIN family f ON r.parent_token_hash = f.token_hash
+)
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE token_hash IN (SELECT token_hash FROM family) AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, tokenHash)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.UserID, arg.SessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET rotated_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING token_hash, user_id, created_at, updated_at, expires_at, revoked_at, parent_token_hash, rotated_at, session_id, session_created_at, device_label, user_agent, ip_address
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ParentTokenHash,
+		&i.RotatedAt,
+		&i.SessionID,
+		&i.SessionCreatedAt,
+		&i.DeviceLabel,
+		&i.UserAgent,
+		&i.IpAddress,
+	)
+	return i, err
+}
@@ -12,27 +12,180 @@ import (
 )
 
 type Chirp struct {
-	ID        uuid.UUID
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Body         string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	HiddenAt     sql.NullTime
+}
+
+type ChirpFlag struct {
+	ChirpID   uuid.UUID
+	Reason    string
+	CreatedAt time.Time
+}
+
+type ChirpHashtag struct {
+	ChirpID     uuid.UUID
+	Tag         string
+	StartOffset int32
+	EndOffset   int32
+}
+
+type ChirpLike struct {
 	UserID    uuid.UUID
-	Body      string
+	ChirpID   uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	Word      string
+	Action    string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type LoginAttempt struct {
+	ID        uuid.UUID
+	Email     string
+	UserID    uuid.NullUUID
+	IpAddress string
+	UserAgent string
+	Outcome   string
+	CreatedAt time.Time
+}
+
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	ExpiresAt     time.Time
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID
+	ModeratorID  uuid.NullUUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Note         sql.NullString
+	CreatedAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash        string
+	UserID           uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	ExpiresAt        time.Time
+	RevokedAt        sql.NullTime
+	ParentTokenHash  sql.NullString
+	RotatedAt        sql.NullTime
+	SessionID        uuid.UUID
+	SessionCreatedAt time.Time
+	DeviceLabel      string
+	UserAgent        string
+	IpAddress        string
+}
+
+type Report struct {
+	ID         uuid.UUID
+	ChirpID    uuid.NullUUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    sql.NullString
+	Status     string
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+	ResolvedBy uuid.NullUUID
+}
+
+type Role struct {
+	Name        string
+	Description string
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	TotpSecret       []byte
+	TotpEnabled      bool
+	TotpLastStep     int64
+	EmailVerifiedAt  sql.NullTime
+	SuspendedAt      sql.NullTime
+	SuspensionReason sql.NullString
+}
+
+type UserRole struct {
+	UserID    uuid.UUID
+	Role      string
+	CreatedAt time.Time
 }
@@ -0,0 +1,117 @@
+// Package entities finds hashtags and mentions in chirp bodies.
+//
+// A hashtag is '#' followed by letters, digits or underscores. Users have no
+// handles, so a mention is '@' followed by the email address of a user, e.g.
+// "@jane@example.com". Offsets are counted in Unicode code points.
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Type tells hashtags and mentions apart.
+type Type string
+
+const (
+	Hashtag Type = "hashtag"
+	Mention Type = "mention"
+)
+
+// Entity is a hashtag or mention found in a text. Start and End delimit it,
+// sigil included, as a half-open range of code point offsets. Value is the
+// entity without its sigil: the tag for a hashtag, the email for a mention.
+type Entity struct {
+	Type  Type
+	Value string
+	Start int
+	End   int
+}
+
+// Parse returns the hashtags and mentions in text in order of appearance.
+func Parse(text string) []Entity {
+	var found []Entity
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if i > 0 && isTagRune(runes[i-1]) {
+			continue
+		}
+		var end int
+		var kind Type
+		switch runes[i] {
+		case '#':
+			end = scanHashtag(runes, i+1)
+			kind = Hashtag
+		case '@':
+			end = scanEmail(runes, i+1)
+			kind = Mention
+		default:
+			continue
+		}
+		if end == i+1 {
+			continue
+		}
+		found = append(found, Entity{
+			Type:  kind,
+			Value: string(runes[i+1 : end]),
+			Start: i,
+			End:   end,
+		})
+		i = end - 1
+	}
+	return found
+}
+
+// NormalizeTag returns the form hashtags are stored and looked up in, so that
+// "#Go" and "#go" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_'
+}
+
+// scanHashtag returns the end offset of the tag starting at start.
+func scanHashtag(runes []rune, start int) int {
+	end := start
+	for end < len(runes) && isTagRune(runes[end]) {
+		end++
+	}
+	return end
+}
+
+// scanEmail returns the end offset of the email address starting at start,
+// or start when there is none. Trailing dots and hyphens are treated as
+// punctuation rather than part of the domain.
+func scanEmail(runes []rune, start int) int {
+	end := start
+	for end < len(runes) && isEmailLocalRune(runes[end]) {
+		end++
+	}
+	if end == start || end >= len(runes) || runes[end] != '@' {
+		return start
+	}
+	domainStart := end + 1
+	end = domainStart
+	for end < len(runes) && isEmailDomainRune(runes[end]) {
+		end++
+	}
+	for end > domainStart && (runes[end-1] == '.' || runes[end-1] == '-') {
+		end--
+	}
+	domain := string(runes[domainStart:end])
+	dot := strings.LastIndexByte(domain, '.')
+	if dot <= 0 || len(domain)-dot-1 < 2 {
+		return start
+	}
+	return end
+}
+
+func isEmailLocalRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._%+-", r))
+}
+
+func isEmailDomainRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-')
+}
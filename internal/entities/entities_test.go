@@ -0,0 +1,84 @@
+package entities_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jrmts/Chrispy/internal/entities"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []entities.Entity
+	}{
+		{
+			name: "No entities",
+			text: "just a plain chirp",
+			want: nil,
+		},
+		{
+			name: "Hashtag",
+			text: "learning #golang today",
+			want: []entities.Entity{
+				{Type: entities.Hashtag, Value: "golang", Start: 9, End: 16},
+			},
+		},
+		{
+			name: "Hashtag followed by punctuation",
+			text: "#go!",
+			want: []entities.Entity{
+				{Type: entities.Hashtag, Value: "go", Start: 0, End: 3},
+			},
+		},
+		{
+			name: "Unicode offsets",
+			text: "héllo #café",
+			want: []entities.Entity{
+				{Type: entities.Hashtag, Value: "café", Start: 6, End: 11},
+			},
+		},
+		{
+			name: "Hash inside a word",
+			text: "C# and issue#12",
+			want: nil,
+		},
+		{
+			name: "Mention",
+			text: "hi @jane.doe@example.com.",
+			want: []entities.Entity{
+				{Type: entities.Mention, Value: "jane.doe@example.com", Start: 3, End: 24},
+			},
+		},
+		{
+			name: "At sign without an email",
+			text: "meet @ noon, ping @jane",
+			want: nil,
+		},
+		{
+			name: "Mixed",
+			text: "#a @b@c.io #b",
+			want: []entities.Entity{
+				{Type: entities.Hashtag, Value: "a", Start: 0, End: 2},
+				{Type: entities.Mention, Value: "b@c.io", Start: 3, End: 10},
+				{Type: entities.Hashtag, Value: "b", Start: 11, End: 13},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := entities.Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	if got := entities.NormalizeTag("#GoLang"); got != "golang" {
+		t.Errorf("NormalizeTag() = %q, want %q", got, "golang")
+	}
+}
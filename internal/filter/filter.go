@@ -0,0 +1,217 @@
+// Package filter implements the configurable content filter applied to chirp
+// bodies. Rules match whole words regardless of surrounding punctuation and
+// Unicode case, and each rule decides what happens to a chirp that uses it.
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Action is what the filter does with a chirp containing a matched word.
+type Action string
+
+const (
+	// Mask replaces the word with asterisks.
+	Mask Action = "mask"
+	// Reject refuses the chirp altogether.
+	Reject Action = "reject"
+	// Flag keeps the chirp as written but marks it for review.
+	Flag Action = "flag"
+)
+
+// mask is what a masked word is replaced with.
+const mask = "****"
+
+// ParseAction validates an action name.
+func ParseAction(name string) (Action, error) {
+	switch Action(name) {
+	case Mask, Reject, Flag:
+		return Action(name), nil
+	}
+	return "", fmt.Errorf("unknown filter action %q, expected mask, reject or flag", name)
+}
+
+// Rule ties a word to the action taken when it appears in a chirp.
+type Rule struct {
+	Word   string
+	Action Action
+}
+
+// Result is the outcome of running a chirp body through the filter.
+type Result struct {
+	// Body is the text with every masked word replaced.
+	Body string
+	// Rejected is true when a reject rule matched.
+	Rejected bool
+	// Flagged is true when a flag rule matched.
+	Flagged bool
+	// Matches lists the rules that matched, in order of first appearance.
+	Matches []Rule
+}
+
+// Filter holds the active rule set. It is safe for concurrent use, and its
+// rules can be swapped at runtime with Replace.
+type Filter struct {
+	mu    sync.RWMutex
+	rules map[string]Action
+}
+
+// New returns a filter using the given rules.
+func New(rules []Rule) *Filter {
+	f := &Filter{}
+	f.Replace(rules)
+	return f
+}
+
+// Replace swaps the active rule set. When several rules share a word the last
+// one wins.
+func (f *Filter) Replace(rules []Rule) {
+	indexed := make(map[string]Action, len(rules))
+	for _, rule := range rules {
+		word, err := ParseWord(rule.Word)
+		if err != nil {
+			continue
+		}
+		indexed[word] = rule.Action
+	}
+	f.mu.Lock()
+	f.rules = indexed
+	f.mu.Unlock()
+}
+
+// Apply runs text through the filter. A nil filter lets everything through.
+func (f *Filter) Apply(text string) Result {
+	result := Result{Body: text}
+	if f == nil {
+		return result
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.rules) == 0 {
+		return result
+	}
+
+	var out strings.Builder
+	seen := make(map[string]bool)
+	runes := []rune(text)
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			out.WriteRune(runes[start])
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := string(runes[start:end])
+		start = end
+
+		normalized := Normalize(word)
+		action, ok := f.rules[normalized]
+		if !ok {
+			out.WriteString(word)
+			continue
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			result.Matches = append(result.Matches, Rule{Word: normalized, Action: action})
+		}
+		switch action {
+		case Mask:
+			out.WriteString(mask)
+		case Reject:
+			result.Rejected = true
+			out.WriteString(word)
+		case Flag:
+			result.Flagged = true
+			out.WriteString(word)
+		}
+	}
+	result.Body = out.String()
+	return result
+}
+
+// Normalize folds a word to the form rules are matched in: punctuation and
+// other non-word characters are dropped and case is folded, so "Kerfuffle!"
+// and "KERFUFFLE" both normalize to "kerfuffle".
+func Normalize(word string) string {
+	var out strings.Builder
+	for _, r := range word {
+		if isWordRune(r) {
+			out.WriteRune(foldRune(r))
+		}
+	}
+	return out.String()
+}
+
+// ParseWord validates the word of a rule and returns it normalized. Chirps
+// are matched one word at a time, so a word that punctuation or spaces split
+// into several, like "f-ck", could never match and is refused.
+func ParseWord(word string) (string, error) {
+	parts := strings.FieldsFunc(word, func(r rune) bool { return !isWordRune(r) })
+	switch len(parts) {
+	case 0:
+		return "", fmt.Errorf("word is required")
+	case 1:
+		return Normalize(parts[0]), nil
+	}
+	return "", fmt.Errorf("%q is not a single word: rules cannot contain spaces or punctuation between letters", word)
+}
+
+// isWordRune reports whether r belongs to a word. Everything else (spaces,
+// newlines, punctuation, symbols) separates words.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// foldRune maps r to lower case after going through upper case, which gives
+// every case variant of a letter the same representative, e.g. "ſ", "s" and
+// "S" all fold to "s".
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// LoadFile reads rules from a word list. Each non-empty line holds a word,
+// optionally followed by an action; the action defaults to mask. Lines
+// starting with '#' are comments.
+func LoadFile(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open filter rules: %w", err)
+	}
+	defer file.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected a word and an optional action", path, lineNumber)
+		}
+		if _, err := ParseWord(fields[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		rule := Rule{Word: fields[0], Action: Mask}
+		if len(fields) == 2 {
+			rule.Action, err = ParseAction(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read filter rules: %w", err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,162 @@
+package filter_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrmts/Chrispy/internal/filter"
+)
+
+func TestApply(t *testing.T) {
+	f := filter.New([]filter.Rule{
+		{Word: "kerfuffle", Action: filter.Mask},
+		{Word: "Sharbert", Action: filter.Mask},
+		{Word: "spam", Action: filter.Reject},
+		{Word: "crypto", Action: filter.Flag},
+		{Word: "straße", Action: filter.Mask},
+	})
+
+	tests := []struct {
+		name         string
+		text         string
+		wantBody     string
+		wantRejected bool
+		wantFlagged  bool
+	}{
+		{
+			name:     "No match",
+			text:     "I had something interesting for breakfast",
+			wantBody: "I had something interesting for breakfast",
+		},
+		{
+			name:     "Mixed case",
+			text:     "This is a KerFuffle opinion",
+			wantBody: "This is a **** opinion",
+		},
+		{
+			name:     "Trailing punctuation",
+			text:     "What a kerfuffle! Sharbert?",
+			wantBody: "What a ****! ****?",
+		},
+		{
+			name:     "Newline separated",
+			text:     "first line\nkerfuffle\nlast line",
+			wantBody: "first line\n****\nlast line",
+		},
+		{
+			name:     "Unicode case",
+			text:     "STRASSE is not straße but STRAßE is",
+			wantBody: "STRASSE is not **** but **** is",
+		},
+		{
+			name:     "Word inside another word",
+			text:     "kerfuffles are fine",
+			wantBody: "kerfuffles are fine",
+		},
+		{
+			name:         "Reject",
+			text:         "buy my SPAM",
+			wantBody:     "buy my SPAM",
+			wantRejected: true,
+		},
+		{
+			name:        "Flag keeps the word",
+			text:        "crypto, anyone?",
+			wantBody:    "crypto, anyone?",
+			wantFlagged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.Apply(tt.text)
+			if got.Body != tt.wantBody {
+				t.Errorf("Apply() body = %q, want %q", got.Body, tt.wantBody)
+			}
+			if got.Rejected != tt.wantRejected {
+				t.Errorf("Apply() rejected = %v, want %v", got.Rejected, tt.wantRejected)
+			}
+			if got.Flagged != tt.wantFlagged {
+				t.Errorf("Apply() flagged = %v, want %v", got.Flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestApplyNilFilter(t *testing.T) {
+	var f *filter.Filter
+	got := f.Apply("kerfuffle")
+	if got.Body != "kerfuffle" || got.Rejected || got.Flagged {
+		t.Errorf("Apply() on nil filter = %+v, want the text unchanged", got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	content := "# default words\nkerfuffle\nspam reject\n\ncrypto flag\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := filter.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := []filter.Rule{
+		{Word: "kerfuffle", Action: filter.Mask},
+		{Word: "spam", Action: filter.Reject},
+		{Word: "crypto", Action: filter.Flag},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("LoadFile() = %v, want %v", rules, want)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("LoadFile()[%d] = %v, want %v", i, rules[i], want[i])
+		}
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(bad, []byte("spam delete\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.LoadFile(bad); err == nil {
+		t.Errorf("LoadFile() with unknown action: expected an error")
+	}
+
+	split := filepath.Join(t.TempDir(), "split.txt")
+	if err := os.WriteFile(split, []byte("f-ck reject\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := filter.LoadFile(split); err == nil {
+		t.Errorf("LoadFile() with a word split by punctuation: expected an error")
+	}
+}
+
+func TestParseWord(t *testing.T) {
+	tests := []struct {
+		name    string
+		word    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", word: "kerfuffle", want: "kerfuffle"},
+		{name: "case and trailing punctuation", word: "  KerFuffle! ", want: "kerfuffle"},
+		{name: "unicode case variant", word: "\u212AERFUFFLE", want: "kerfuffle"},
+		{name: "empty", word: " !? ", wantErr: true},
+		{name: "hyphenated", word: "f-ck", wantErr: true},
+		{name: "two words", word: "free money", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filter.ParseWord(tt.word)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWord(%q) error = %v, wantErr %v", tt.word, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseWord(%q) = %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
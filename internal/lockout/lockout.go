@@ -0,0 +1,185 @@
+// Package lockout slows down password guessing. It counts failed logins per
+// account and per client address, makes each key wait exponentially longer
+// between attempts once it has used up its free attempts, and locks it for a
+// while after too many failures.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// maxBackoffShift bounds the doubling of the backoff delay so that it cannot
+// overflow a time.Duration.
+const maxBackoffShift = 30
+
+// Policy decides how long a key has to wait after a number of failures.
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before backoff starts.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts. It
+	// doubles with each further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAttempts is the number of failures that locks the key for
+	// LockoutDuration. Zero never locks the key.
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// ResetAfter is how long a key has to go without a failure before its
+	// count starts over.
+	ResetAfter time.Duration
+}
+
+// DefaultAccountPolicy allows five wrong passwords for an account, then backs
+// off up to a minute, and locks the account for 15 minutes after ten.
+var DefaultAccountPolicy = Policy{
+	FreeAttempts:    5,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      time.Hour,
+}
+
+// DefaultIPPolicy is looser than DefaultAccountPolicy, since many users can
+// share an address behind a NAT, but still stops a single client from trying
+// passwords against many accounts.
+var DefaultIPPolicy = Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 100,
+	LockoutDuration: time.Hour,
+	ResetAfter:      time.Hour,
+}
+
+// Delay returns how long a key has to wait after its last failure, given its
+// number of failures.
+func (policy Policy) Delay(failures int) time.Duration {
+	if policy.LockoutAttempts > 0 && failures >= policy.LockoutAttempts {
+		return policy.LockoutDuration
+	}
+	if failures <= policy.FreeAttempts {
+		return 0
+	}
+	shift := min(failures-policy.FreeAttempts-1, maxBackoffShift)
+	return min(policy.BaseDelay<<shift, policy.MaxDelay)
+}
+
+// Counter is the failure count of a key.
+type Counter struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps the failure counters. MemoryStore suits a single server;
+// PostgresStore shares the counters between several.
+type Store interface {
+	// Get returns the counter of key, or a zero Counter when it has no
+	// failures or they expired before now.
+	Get(ctx context.Context, key string, now time.Time) (Counter, error)
+	// Fail records a failure of key at now and returns the new counter. A
+	// counter expires, and starts over, when no failure is recorded for ttl.
+	Fail(ctx context.Context, key string, now time.Time, ttl time.Duration) (Counter, error)
+	// Reset forgets the failures of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter applies the account and address policies to login attempts. A nil
+// Limiter lets every attempt through.
+type Limiter struct {
+	Store   Store
+	Account Policy
+	IP      Policy
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// New returns a limiter with the default policies.
+func New(store Store) *Limiter {
+	return &Limiter{
+		Store:   store,
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+	}
+}
+
+// AccountKey is the key the failures of an account are counted under. It
+// uses the email that was tried, so that unknown accounts are throttled the
+// same way as existing ones.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPKey is the key the failures of a client address are counted under.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the client has to wait before it may try to log in
+// to the account again. Zero means it may try now.
+func (limiter *Limiter) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	if limiter == nil {
+		return 0, nil
+	}
+	now := limiter.now()
+	account, err := limiter.Store.Get(ctx, AccountKey(email), now)
+	if err != nil {
+		return 0, err
+	}
+	address, err := limiter.Store.Get(ctx, IPKey(ip), now)
+	if err != nil {
+		return 0, err
+	}
+	return max(wait(limiter.Account, account, now), wait(limiter.IP, address, now)), nil
+}
+
+// Fail records a failed login to the account from the address, and returns
+// how long the client has to wait before its next attempt.
+func (limiter *Limiter) Fail(ctx context.Context, email, ip string) (time.Duration, error) {
+	if limiter == nil {
+		return 0, nil
+	}
+	now := limiter.now()
+	account, err := limiter.Store.Fail(ctx, AccountKey(email), now, limiter.Account.ResetAfter)
+	if err != nil {
+		return 0, err
+	}
+	address, err := limiter.Store.Fail(ctx, IPKey(ip), now, limiter.IP.ResetAfter)
+	if err != nil {
+		return 0, err
+	}
+	return max(wait(limiter.Account, account, now), wait(limiter.IP, address, now)), nil
+}
+
+// Succeed clears the failures of an account after a successful login. The
+// failures of the address are kept: a client guessing passwords for many
+// accounts must not be able to clear them by logging in to its own.
+func (limiter *Limiter) Succeed(ctx context.Context, email string) error {
+	return limiter.Unlock(ctx, email)
+}
+
+// Unlock clears the failures of an account, lifting any backoff or lockout.
+func (limiter *Limiter) Unlock(ctx context.Context, email string) error {
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Store.Reset(ctx, AccountKey(email))
+}
+
+func (limiter *Limiter) now() time.Time {
+	if limiter.Now != nil {
+		return limiter.Now()
+	}
+	return time.Now()
+}
+
+// wait returns how much of the delay the policy imposes on counter is left
+// at now.
+func wait(policy Policy, counter Counter, now time.Time) time.Duration {
+	if counter.Failures == 0 {
+		return 0
+	}
+	return max(counter.LastFailure.Add(policy.Delay(counter.Failures)).Sub(now), 0)
+}
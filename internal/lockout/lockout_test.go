@@ -0,0 +1,130 @@
+package lockout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jrmts/Chrispy/internal/lockout"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Second,
+		LockoutAttempts: 8,
+		LockoutDuration: time.Hour,
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "No failures", failures: 0, want: 0},
+		{name: "Free attempts", failures: 3, want: 0},
+		{name: "First backoff", failures: 4, want: time.Second},
+		{name: "Doubles", failures: 6, want: 4 * time.Second},
+		{name: "Capped", failures: 7, want: 5 * time.Second},
+		{name: "Locked out", failures: 8, want: time.Hour},
+		{name: "Stays locked out", failures: 50, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Delay(tt.failures); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+
+	unlimited := lockout.Policy{FreeAttempts: 0, BaseDelay: time.Second, MaxDelay: time.Hour}
+	if got := unlimited.Delay(1000); got != time.Hour {
+		t.Errorf("Delay(1000) = %v, want the maximum delay", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := lockout.New(lockout.NewMemoryStore())
+	limiter.Account = lockout.Policy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAttempts: 5,
+		LockoutDuration: 15 * time.Minute,
+		ResetAfter:      time.Hour,
+	}
+	limiter.IP = lockout.Policy{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, ResetAfter: time.Hour}
+	limiter.Now = func() time.Time { return now }
+
+	check := func(email, ip string, want time.Duration) {
+		t.Helper()
+		got, err := limiter.Check(ctx, email, ip)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Check(%q, %q) = %v, want %v", email, ip, got, want)
+		}
+	}
+	fail := func(email, ip string) {
+		t.Helper()
+		if _, err := limiter.Fail(ctx, email, ip); err != nil {
+			t.Fatalf("Fail() error = %v", err)
+		}
+	}
+
+	fail("walt@example.com", "10.0.0.1")
+	fail("Walt@Example.com ", "10.0.0.2")
+	check("walt@example.com", "10.0.0.3", 0)
+
+	fail("walt@example.com", "10.0.0.1")
+	check("walt@example.com", "10.0.0.3", time.Second)
+	now = now.Add(time.Second)
+	check("walt@example.com", "10.0.0.3", 0)
+
+	fail("walt@example.com", "10.0.0.1")
+	check("walt@example.com", "10.0.0.3", 2*time.Second)
+
+	// The address has failed three times against walt, so its next failure
+	// on any account backs it off.
+	fail("jesse@example.com", "10.0.0.1")
+	check("skyler@example.com", "10.0.0.1", time.Minute)
+	check("skyler@example.com", "10.0.0.3", 0)
+
+	fail("walt@example.com", "10.0.0.3")
+	check("walt@example.com", "10.0.0.4", 15*time.Minute)
+
+	if err := limiter.Succeed(ctx, "jesse@example.com"); err != nil {
+		t.Fatalf("Succeed() error = %v", err)
+	}
+	check("jesse@example.com", "10.0.0.1", time.Minute)
+
+	if err := limiter.Unlock(ctx, "WALT@example.com"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	check("walt@example.com", "10.0.0.4", 0)
+
+	fail("gus@example.com", "10.0.0.5")
+	fail("gus@example.com", "10.0.0.5")
+	fail("gus@example.com", "10.0.0.5")
+	now = now.Add(2 * time.Hour)
+	check("gus@example.com", "10.0.0.5", 0)
+	fail("gus@example.com", "10.0.0.5")
+	check("gus@example.com", "10.0.0.5", 0)
+}
+
+func TestNilLimiter(t *testing.T) {
+	var limiter *lockout.Limiter
+	wait, err := limiter.Fail(context.Background(), "walt@example.com", "10.0.0.1")
+	if err != nil || wait != 0 {
+		t.Errorf("Fail() = %v, %v, want 0, nil", wait, err)
+	}
+	wait, err = limiter.Check(context.Background(), "walt@example.com", "10.0.0.1")
+	if err != nil || wait != 0 {
+		t.Errorf("Check() = %v, %v, want 0, nil", wait, err)
+	}
+}
@@ -0,0 +1,74 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// minSweepSize is the number of counters a MemoryStore holds before it
+// starts dropping expired ones.
+const minSweepSize = 1024
+
+// MemoryStore keeps the counters in memory. It is safe for concurrent use,
+// but the counters are lost on restart and are not shared between servers.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+	sweepAt  int
+}
+
+type memoryCounter struct {
+	Counter
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters: make(map[string]memoryCounter),
+		sweepAt:  minSweepSize,
+	}
+}
+
+func (store *MemoryStore) Get(ctx context.Context, key string, now time.Time) (Counter, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	counter, ok := store.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		return Counter{}, nil
+	}
+	return counter.Counter, nil
+}
+
+func (store *MemoryStore) Fail(ctx context.Context, key string, now time.Time, ttl time.Duration) (Counter, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	counter := store.counters[key]
+	if !now.Before(counter.expiresAt) {
+		counter = memoryCounter{}
+	}
+	counter.Failures++
+	counter.LastFailure = now
+	counter.expiresAt = now.Add(ttl)
+	store.counters[key] = counter
+
+	// Drop expired counters whenever the map has doubled, so that guesses
+	// against many accounts do not grow it forever.
+	if len(store.counters) >= store.sweepAt {
+		for key, counter := range store.counters {
+			if !now.Before(counter.expiresAt) {
+				delete(store.counters, key)
+			}
+		}
+		store.sweepAt = max(2*len(store.counters), minSweepSize)
+	}
+	return counter.Counter, nil
+}
+
+func (store *MemoryStore) Reset(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.counters, key)
+	return nil
+}
@@ -0,0 +1,65 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jrmts/Chrispy/internal/database"
+)
+
+// pruneInterval is the number of failures a PostgresStore records between
+// deletions of expired counters.
+const pruneInterval = 1000
+
+// PostgresStore keeps the counters in the login_throttles table, so that
+// every server behind a load balancer sees the same failures. Timestamps are
+// written in UTC because the columns have no time zone.
+type PostgresStore struct {
+	queries  *database.Queries
+	failures atomic.Int64
+}
+
+// NewPostgresStore returns a store using the given queries.
+func NewPostgresStore(queries *database.Queries) *PostgresStore {
+	return &PostgresStore{queries: queries}
+}
+
+func (store *PostgresStore) Get(ctx context.Context, key string, now time.Time) (Counter, error) {
+	row, err := store.queries.GetLoginThrottle(ctx, database.GetLoginThrottleParams{
+		Key:       key,
+		ExpiresAt: now.UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Counter{}, nil
+	}
+	if err != nil {
+		return Counter{}, err
+	}
+	return Counter{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, nil
+}
+
+func (store *PostgresStore) Fail(ctx context.Context, key string, now time.Time, ttl time.Duration) (Counter, error) {
+	now = now.UTC()
+	row, err := store.queries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:           key,
+		LastFailureAt: now,
+		ExpiresAt:     now.Add(ttl),
+	})
+	if err != nil {
+		return Counter{}, err
+	}
+	if store.failures.Add(1)%pruneInterval == 0 {
+		err = store.queries.DeleteExpiredLoginThrottles(ctx, now)
+		if err != nil {
+			return Counter{}, err
+		}
+	}
+	return Counter{Failures: int(row.Failures), LastFailure: row.LastFailureAt}, nil
+}
+
+func (store *PostgresStore) Reset(ctx context.Context, key string) error {
+	return store.queries.DeleteLoginThrottle(ctx, key)
+}
@@ -0,0 +1,109 @@
+// Package mail sends the emails Chirpy writes to its users, such as password
+// resets. Mailer is the extension point: SMTPMailer delivers through a mail
+// server, and FileMailer writes the messages to a file or the log for
+// development and tests.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Format renders the message as an RFC 5322 email from the given address. It
+// refuses header values containing line breaks, which could smuggle in extra
+// headers.
+func Format(from string, message Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header value %q", value)
+		}
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "From: %s\r\n", from)
+	fmt.Fprintf(&out, "To: %s\r\n", message.To)
+	fmt.Fprintf(&out, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&out, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	out.WriteString("MIME-Version: 1.0\r\n")
+	out.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	out.WriteString("\r\n")
+	out.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(out.String()), nil
+}
+
+// SMTPMailer delivers messages through an SMTP server. Auth is used when it
+// is set, and requires the server to offer TLS unless it runs on localhost.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	data, err := Format(mailer.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+	err = smtp.SendMail(mailer.Addr, mailer.Auth, mailer.From, []string{message.To}, data)
+	if err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", message.To, err)
+	}
+	return nil
+}
+
+// FileMailer writes every message to a writer instead of sending it. It is
+// safe for concurrent use.
+type FileMailer struct {
+	From string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewFileMailer appends messages to the file at path.
+func NewFileMailer(from, path string) (*FileMailer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mail file: %w", err)
+	}
+	return &FileMailer{From: from, out: file}, nil
+}
+
+// NewLogMailer writes messages to the standard logger's output.
+func NewLogMailer(from string) *FileMailer {
+	return &FileMailer{From: from, out: log.Writer()}
+}
+
+// NewWriterMailer writes messages to out.
+func NewWriterMailer(from string, out io.Writer) *FileMailer {
+	return &FileMailer{From: from, out: out}
+}
+
+func (mailer *FileMailer) Send(ctx context.Context, message Message) error {
+	data, err := Format(mailer.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	_, err = fmt.Fprintf(mailer.out, "%s\r\n.\r\n", data)
+	return err
+}
@@ -0,0 +1,69 @@
+package mail_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrmts/Chrispy/internal/mail"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		message mail.Message
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Plain message",
+			message: mail.Message{To: "walt@example.com", Subject: "Hello", Body: "line one\nline two\n"},
+			want: "From: chirpy@example.com\r\n" +
+				"To: walt@example.com\r\n" +
+				"Subject: Hello\r\n" +
+				"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: text/plain; charset=UTF-8\r\n" +
+				"\r\n" +
+				"line one\r\nline two\r\n",
+		},
+		{
+			name:    "Header injection in subject",
+			message: mail.Message{To: "walt@example.com", Subject: "Hello\r\nBcc: jesse@example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "Header injection in recipient",
+			message: mail.Message{To: "walt@example.com\nBcc: jesse@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mail.Format("chirpy@example.com", tt.message, date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	var out bytes.Buffer
+	mailer := mail.NewWriterMailer("chirpy@example.com", &out)
+	err := mailer.Send(context.Background(), mail.Message{To: "walt@example.com", Subject: "Reset", Body: "token abc"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "To: walt@example.com\r\n") || !strings.Contains(out.String(), "token abc") {
+		t.Errorf("Send() wrote %q", out.String())
+	}
+}
@@ -0,0 +1,86 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrmts/Chrispy/internal/totp"
+)
+
+// The SHA-1 test vectors of RFC 6238, truncated to six digits.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		unix int64
+		want string
+	}{
+		{name: "Epoch plus 59s", unix: 59, want: "287082"},
+		{name: "1111111109", unix: 1111111109, want: "081804"},
+		{name: "1111111111", unix: 1111111111, want: "050471"},
+		{name: "1234567890", unix: 1234567890, want: "005924"},
+		{name: "2000000000", unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := totp.Code(rfcSecret, totp.Step(time.Unix(tt.unix, 0)))
+			if got != tt.want {
+				t.Errorf("Code() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current code", code: "005924", wantStep: totp.Step(now), wantOK: true},
+		{name: "Previous code", code: totp.Code(rfcSecret, totp.Step(now)-1), wantStep: totp.Step(now) - 1, wantOK: true},
+		{name: "Code too old", code: totp.Code(rfcSecret, totp.Step(now)-2), wantOK: false},
+		{name: "Wrong code", code: "000000", wantOK: false},
+		{name: "Wrong length", code: "05924", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totp.Validate(rfcSecret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = %v, %v, want %v, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("Chirpy", "jane@example.com", rfcSecret)
+	want := "otpauth://totp/Chirpy:jane@example.com?"
+	if !strings.HasPrefix(uri, want) {
+		t.Errorf("URI() = %v, want prefix %v", uri, want)
+	}
+	if !strings.Contains(uri, "secret="+totp.EncodeSecret(rfcSecret)) {
+		t.Errorf("URI() = %v, missing secret", uri)
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	codes, err := totp.GenerateRecoveryCodes(2)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() error = %v", err)
+	}
+	if codes[0] == codes[1] {
+		t.Errorf("GenerateRecoveryCodes() returned duplicate codes")
+	}
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if totp.HashRecoveryCode(typed) != totp.HashRecoveryCode(codes[0]) {
+		t.Errorf("HashRecoveryCode() depends on case and separators")
+	}
+}
@@ -1,23 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
 	"database/sql"
+	"encoding/base64"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/smtp"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/jrmts/Chrispy/internal/api"
+	"github.com/jrmts/Chrispy/internal/auth"
 
 	// Importing pq for PostgreSQL driver
 
 	"github.com/joho/godotenv"
 	"github.com/jrmts/Chrispy/internal/database"
+	"github.com/jrmts/Chrispy/internal/filter"
+	"github.com/jrmts/Chrispy/internal/lockout"
+	"github.com/jrmts/Chrispy/internal/mail"
 	_ "github.com/lib/pq"
 )
 
+// minSecretKeyLength is the shortest SECRET_KEY accepted. An empty key would
+// let anyone sign two-factor challenges.
+const minSecretKeyLength = 32
+
 func main() {
 	log.Println("Go version:", runtime.Version())
 	godotenv.Load()
@@ -25,26 +43,106 @@ func main() {
 	dbURL := os.Getenv("DB_URL")
 	secretKey := os.Getenv("SECRET_KEY")
 	polkaKey := os.Getenv("POLKA_KEY")
+	filterRulesFile := os.Getenv("FILTER_RULES_FILE")
+	loginThrottleStore := os.Getenv("LOGIN_THROTTLE_STORE")
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	if len(secretKey) < minSecretKeyLength {
+		log.Fatalf("SECRET_KEY must be at least %d bytes", minSecretKeyLength)
+	}
+	totpKey, err := base64.StdEncoding.DecodeString(os.Getenv("TOTP_KEY"))
+	if err != nil || (len(totpKey) != 0 && len(totpKey) != auth.EncryptionKeySize) {
+		log.Fatalf("TOTP_KEY must be %d bytes encoded in base64", auth.EncryptionKeySize)
+	}
+	reportHideThreshold := 5
+	if value := os.Getenv("REPORT_HIDE_THRESHOLD"); value != "" {
+		reportHideThreshold, err = strconv.Atoi(value)
+		if err != nil || reportHideThreshold < 0 {
+			log.Fatal("REPORT_HIDE_THRESHOLD must be a non-negative integer")
+		}
+	}
+	mailer, err := loadMailer()
+	if err != nil {
+		log.Fatal("cannot set up mailer: ", err)
+	}
+	trustedProxies, err := loadTrustedProxies()
+	if err != nil {
+		log.Fatal("cannot load trusted proxies: ", err)
+	}
+	passwordHasher, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatal("cannot configure password hashing: ", err)
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatal("cannot load password policy: ", err)
+	}
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		log.Fatal("cannot load JWT keys: ", err)
+	}
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("cannot connect to database: ", err)
 	}
 	dbQueries := database.New(db)
 	apiConfiguration := &api.APIConfig{
-		FileserverHits: atomic.Int32{},
-		Queries:        dbQueries,
-		Platform:       platform,
-		SecretKey:      secretKey,
-		PolkaKey:       polkaKey,
+		FileserverHits:       atomic.Int32{},
+		DB:                   db,
+		Queries:              dbQueries,
+		Platform:             platform,
+		SecretKey:            secretKey,
+		JWTKeys:              jwtKeys,
+		PolkaKey:             polkaKey,
+		TOTPKey:              totpKey,
+		Mailer:               mailer,
+		PasswordHasher:       passwordHasher,
+		PasswordPolicy:       passwordPolicy,
+		RequireVerifiedEmail: requireVerifiedEmail,
+		ReportHideThreshold:  reportHideThreshold,
+		TrustedProxies:       trustedProxies,
+		ContentFilter:        filter.New(nil),
+	}
+	switch loginThrottleStore {
+	case "", "memory":
+		apiConfiguration.LoginLimiter = lockout.New(lockout.NewMemoryStore())
+	case "postgres":
+		apiConfiguration.LoginLimiter = lockout.New(lockout.NewPostgresStore(dbQueries))
+	default:
+		log.Fatalf("LOGIN_THROTTLE_STORE must be memory or postgres, not %q", loginThrottleStore)
+	}
+	if filterRulesFile != "" {
+		apiConfiguration.FilterFileRules, err = filter.LoadFile(filterRulesFile)
+		if err != nil {
+			log.Fatal("cannot load content filter rules: ", err)
+		}
+	}
+	err = apiConfiguration.ReloadContentFilter()
+	if err != nil {
+		log.Fatal("cannot load content filter rules: ", err)
 	}
 
 	// const port = "8080"
 	// const filepathRoot = "."
 	port := flag.String("port", "8080", "TCP port to listen on")
 	filepathRoot := flag.String("root", ".", "Static file root directory")
+	promoteAdmin := flag.String("promote-admin", "", "Grant the admin role to the user with this email, then exit")
 	flag.Parse()
 
+	if *promoteAdmin != "" {
+		err = promoteToAdmin(dbQueries, *promoteAdmin)
+		if err != nil {
+			log.Fatal("cannot promote user to admin: ", err)
+		}
+		log.Printf("%s is now an admin", *promoteAdmin)
+		return
+	}
+
 	mux := http.NewServeMux()
+	requireAuth := func(handler http.HandlerFunc) http.Handler { return apiConfiguration.RequireAuth(handler) }
+	optionalAuth := func(handler http.HandlerFunc) http.Handler { return apiConfiguration.OptionalAuth(handler) }
+	requirePermission := func(permission auth.Permission, handler http.HandlerFunc) http.Handler {
+		return apiConfiguration.RequireAuth(apiConfiguration.RequirePermission(permission, handler))
+	}
 
 	fileSystem := http.Dir(*filepathRoot) // "." means current directory
 	fileServer := http.FileServer(fileSystem)
@@ -54,21 +152,68 @@ func main() {
 	mux.Handle("/app/", apiConfiguration.MiddlewareMetricsInc(http.StripPrefix(("/app/"), fileServer)))
 
 	mux.HandleFunc("GET /api/healthz", api.HandleHealthCheck)
-	mux.HandleFunc("GET /admin/metrics", apiConfiguration.HandleMetrics)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiConfiguration.HandleJWKS)
+	mux.Handle("GET /admin/metrics", requirePermission(auth.PermissionViewMetrics, apiConfiguration.HandleMetrics))
 	// mux.HandleFunc("/reset", apiConfiguration.resetMetric)
-	mux.Handle("POST /admin/reset", http.HandlerFunc(apiConfiguration.ResetMetric))
+	mux.Handle("POST /admin/reset", requirePermission(auth.PermissionResetData, apiConfiguration.ResetMetric))
+	mux.Handle("GET /admin/filter/rules", requirePermission(auth.PermissionManageFilter, apiConfiguration.ListFilterRules))
+	mux.Handle("POST /admin/filter/rules", requirePermission(auth.PermissionManageFilter, apiConfiguration.CreateFilterRule))
+	mux.Handle("DELETE /admin/filter/rules/{id}", requirePermission(auth.PermissionManageFilter, apiConfiguration.DeleteFilterRule))
+	mux.Handle("GET /admin/filter/flags", requirePermission(auth.PermissionReviewContent, apiConfiguration.ListFlaggedChirps))
+	mux.Handle("GET /admin/reports", requirePermission(auth.PermissionReviewContent, apiConfiguration.ListReports))
+	mux.Handle("POST /admin/reports/{id}/resolve", requirePermission(auth.PermissionReviewContent, apiConfiguration.ResolveReport))
+	mux.Handle("GET /admin/users", requirePermission(auth.PermissionManageUsers, apiConfiguration.ListUsers))
+	mux.Handle("GET /admin/users/{id}", requirePermission(auth.PermissionManageUsers, apiConfiguration.GetUser))
+	mux.Handle("DELETE /admin/users/{id}", requirePermission(auth.PermissionManageUsers, apiConfiguration.DeleteUser))
+	mux.Handle("POST /admin/users/{id}/suspend", requirePermission(auth.PermissionManageUsers, apiConfiguration.SuspendUser))
+	mux.Handle("POST /admin/users/{id}/unsuspend", requirePermission(auth.PermissionManageUsers, apiConfiguration.UnsuspendUser))
+	mux.Handle("POST /admin/users/{id}/logout", requirePermission(auth.PermissionManageUsers, apiConfiguration.ForceLogoutUser))
+	mux.Handle("POST /admin/users/{id}/unlock", requirePermission(auth.PermissionManageUsers, apiConfiguration.UnlockUser))
+	mux.Handle("GET /admin/users/{id}/roles", requirePermission(auth.PermissionManageUsers, apiConfiguration.GetUserRoles))
+	mux.Handle("PUT /admin/users/{id}/roles/{role}", requirePermission(auth.PermissionManageUsers, apiConfiguration.GrantUserRole))
+	mux.Handle("DELETE /admin/users/{id}/roles/{role}", requirePermission(auth.PermissionManageUsers, apiConfiguration.RevokeUserRole))
 
-	mux.HandleFunc("POST /api/chirps", apiConfiguration.Chirps)
-	mux.HandleFunc("GET /api/chirps", apiConfiguration.GetChirps)
-	mux.HandleFunc("GET /api/chirps/{id}", apiConfiguration.GetChirpByID)
-	mux.HandleFunc("DELETE /api/chirps/{id}", apiConfiguration.DeleteOneChirp)
+	mux.Handle("POST /api/chirps", requireAuth(apiConfiguration.Chirps))
+	mux.Handle("GET /api/chirps", optionalAuth(apiConfiguration.GetChirps))
+	mux.Handle("GET /api/chirps/search", optionalAuth(apiConfiguration.SearchChirps))
+	mux.Handle("GET /api/chirps/{id}", optionalAuth(apiConfiguration.GetChirpByID))
+	mux.Handle("GET /api/chirps/{id}/thread", optionalAuth(apiConfiguration.GetChirpThread))
+	mux.Handle("PATCH /api/chirps/{id}", requireAuth(apiConfiguration.EditChirp))
+	mux.Handle("DELETE /api/chirps/{id}", requireAuth(apiConfiguration.DeleteOneChirp))
+	mux.Handle("GET /api/chirps/{id}/history", optionalAuth(apiConfiguration.GetChirpHistory))
+	mux.Handle("POST /api/chirps/{id}/report", requireAuth(apiConfiguration.ReportChirp))
+	mux.Handle("POST /api/chirps/{id}/rechirp", requireAuth(apiConfiguration.Rechirp))
+	mux.Handle("POST /api/chirps/{id}/like", requireAuth(apiConfiguration.LikeChirp))
+	mux.Handle("DELETE /api/chirps/{id}/like", requireAuth(apiConfiguration.UnlikeChirp))
+	mux.Handle("GET /api/chirps/{id}/likes", optionalAuth(apiConfiguration.GetChirpLikes))
+	mux.Handle("GET /api/hashtags/{tag}/chirps", optionalAuth(apiConfiguration.GetHashtagChirps))
 
 	mux.HandleFunc("POST /api/users", apiConfiguration.CreateUser)
 	mux.HandleFunc("POST /api/login", apiConfiguration.LoginUser)
+	mux.HandleFunc("POST /api/login/2fa", apiConfiguration.LoginTwoFactor)
+	mux.HandleFunc("POST /api/password/forgot", apiConfiguration.ForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiConfiguration.ResetPassword)
 	mux.HandleFunc("POST /api/refresh", apiConfiguration.RefreshToken)
 	mux.HandleFunc("POST /api/revoke", apiConfiguration.RevokeToken)
+	mux.Handle("GET /api/sessions", requireAuth(apiConfiguration.ListSessions))
+	mux.Handle("DELETE /api/sessions/{id}", requireAuth(apiConfiguration.RevokeSession))
+	mux.Handle("POST /api/sessions/revoke-all", requireAuth(apiConfiguration.RevokeAllSessions))
+	mux.Handle("POST /api/tokens", requireAuth(apiConfiguration.CreatePersonalAccessToken))
+	mux.Handle("GET /api/tokens", requireAuth(apiConfiguration.ListPersonalAccessTokens))
+	mux.Handle("DELETE /api/tokens/{id}", requireAuth(apiConfiguration.RevokePersonalAccessToken))
 
-	mux.HandleFunc("PUT /api/users", apiConfiguration.UpdateUser)
+	mux.Handle("PUT /api/users", requireAuth(apiConfiguration.UpdateUser))
+	mux.HandleFunc("GET /api/users/verify", apiConfiguration.VerifyEmail)
+	mux.Handle("POST /api/users/verify/resend", requireAuth(apiConfiguration.ResendVerificationEmail))
+	mux.Handle("POST /api/users/2fa/setup", requireAuth(apiConfiguration.SetupTwoFactor))
+	mux.Handle("POST /api/users/2fa/confirm", requireAuth(apiConfiguration.ConfirmTwoFactor))
+	mux.Handle("POST /api/users/2fa/disable", requireAuth(apiConfiguration.DisableTwoFactor))
+	mux.Handle("POST /api/users/{id}/follow", requireAuth(apiConfiguration.FollowUser))
+	mux.Handle("DELETE /api/users/{id}/follow", requireAuth(apiConfiguration.UnfollowUser))
+	mux.HandleFunc("GET /api/users/{id}/followers", apiConfiguration.GetFollowers)
+	mux.HandleFunc("GET /api/users/{id}/following", apiConfiguration.GetFollowing)
+	mux.Handle("GET /api/users/{id}/mentions", optionalAuth(apiConfiguration.GetUserMentions))
+	mux.Handle("GET /api/timeline", requireAuth(apiConfiguration.GetTimeline))
 	mux.HandleFunc("POST /api/polka/webhooks", apiConfiguration.UpdateChirpyRed)
 
 	server := &http.Server{
@@ -79,3 +224,186 @@ func main() {
 	log.Printf("Serving on port: %s\n", *port)
 	log.Fatal(server.ListenAndServe())
 }
+
+// promoteToAdmin grants the admin role to the user with the given email, so
+// that a fresh deployment can get its first admin.
+func promoteToAdmin(queries *database.Queries, email string) error {
+	user, err := queries.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		return fmt.Errorf("no user with email %s: %w", email, err)
+	}
+	return queries.GrantUserRole(context.Background(), database.GrantUserRoleParams{
+		UserID: user.ID,
+		Role:   string(auth.RoleAdmin),
+	})
+}
+
+// loadJWTKeys builds the access token key set from JWT_SIGNING_KEY_FILE and
+// the comma-separated JWT_VERIFICATION_KEY_FILES. Without a signing key a
+// temporary one is generated, and tokens stop working on restart.
+func loadJWTKeys() (*auth.KeySet, error) {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "chirpy"
+	}
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = "chirpy"
+	}
+
+	var signer crypto.Signer
+	signingKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if signingKeyFile != "" {
+		var err error
+		signer, err = auth.LoadSigningKey(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Println("JWT_SIGNING_KEY_FILE is not set, signing access tokens with a temporary key")
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		signer = key
+	}
+
+	var verificationKeys []crypto.PublicKey
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := auth.LoadVerificationKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+	return auth.NewKeySet(issuer, audience, signer, verificationKeys...)
+}
+
+// loadMailer picks how emails are sent. With SMTP_ADDR set they go through
+// that server, authenticating with SMTP_USERNAME and SMTP_PASSWORD when given.
+// Otherwise they are appended to MAIL_FILE, or written to the log.
+func loadMailer() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	smtpAddr := os.Getenv("SMTP_ADDR")
+	if smtpAddr != "" {
+		mailer := &mail.SMTPMailer{Addr: smtpAddr, From: from}
+		username := os.Getenv("SMTP_USERNAME")
+		if username != "" {
+			host, _, err := net.SplitHostPort(smtpAddr)
+			if err != nil {
+				return nil, err
+			}
+			mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mailer, nil
+	}
+
+	mailFile := os.Getenv("MAIL_FILE")
+	if mailFile != "" {
+		return mail.NewFileMailer(from, mailFile)
+	}
+	log.Println("SMTP_ADDR and MAIL_FILE are not set, writing emails to the log")
+	return mail.NewLogMailer(from), nil
+}
+
+// loadTrustedProxies parses TRUSTED_PROXIES, a comma-separated list of the
+// addresses or CIDR ranges of the proxies in front of the server. Without it
+// client addresses are taken from the connection, so behind a load balancer
+// every client shares the balancer's address.
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// loadPasswordHasher returns an argon2id hasher with the default parameters,
+// overridden by ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM.
+// Raising them makes every older hash be replaced at its user's next login.
+// Only as many hashes run at once as fit in PASSWORD_HASH_MEMORY_MIB
+// (512 by default), and at least one.
+func loadPasswordHasher() (auth.PasswordHasher, error) {
+	params := auth.DefaultArgon2idParams
+	for _, setting := range []struct {
+		name  string
+		bits  int
+		value func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("%s must be a positive integer", setting.name)
+		}
+		setting.value(parsed)
+	}
+	budgetMiB := uint64(512)
+	if value := os.Getenv("PASSWORD_HASH_MEMORY_MIB"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("PASSWORD_HASH_MEMORY_MIB must be a positive integer")
+		}
+		budgetMiB = parsed
+	}
+	maxConcurrent := int(budgetMiB * 1024 / uint64(params.Memory))
+	return auth.NewLimitedHasher(&auth.Argon2idHasher{Params: params}, maxConcurrent), nil
+}
+
+// loadPasswordPolicy starts from auth.DefaultPasswordPolicy and applies
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_ENTROPY and BREACHED_PASSWORDS_PATH.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		minLength, err := strconv.Atoi(value)
+		if err != nil {
+			return policy, fmt.Errorf("PASSWORD_MIN_LENGTH: %w", err)
+		}
+		policy.MinLength = minLength
+	}
+	if value := os.Getenv("PASSWORD_MIN_ENTROPY"); value != "" {
+		minEntropy, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return policy, fmt.Errorf("PASSWORD_MIN_ENTROPY: %w", err)
+		}
+		policy.MinEntropyBits = minEntropy
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+		breached, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
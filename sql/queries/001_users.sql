@@ -19,8 +19,21 @@ SELECT * FROM users WHERE id = $1;
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
--- name: UpdateUser :exec
-UPDATE users SET email = $1, hashed_password = $2, updated_at = NOW() WHERE id = $3;
+-- name: UpdateUser :one
+UPDATE users SET
+    email = $1,
+    hashed_password = $2,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+    updated_at = NOW()
+WHERE id = $3
+RETURNING *;
 
 -- name: UpdateChirpyRed :exec
-UPDATE users SET is_chirpy_red = TRUE WHERE id = $1;
\ No newline at end of file
+UPDATE users SET is_chirpy_red = TRUE WHERE id = $1;
+
+-- name: GetUsersByEmails :many
+SELECT * FROM users WHERE email = ANY(sqlc.arg('emails')::text[]);
+
+-- name: RehashUserPassword :exec
+UPDATE users SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
@@ -1,10 +1,24 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
     $2
 )
 RETURNING *;
@@ -12,14 +26,81 @@ RETURNING *;
 -- name: DeleteAllChirps :exec
 DELETE FROM chirps;
 
--- name: GetAllChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC; 
-
 -- name: GetChirpByID :one
 SELECT * FROM chirps WHERE id = $1;
 
+-- name: GetChirpByIDForUpdate :one
+SELECT * FROM chirps WHERE id = $1 FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $1, updated_at = NOW() WHERE id = $2
+RETURNING *;
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
 -- name: DeleteOneChirps :exec
 DELETE FROM chirps WHERE id = $1;
 
--- name: GetChirpByAuthorID :many
-SELECT * FROM chirps WHERE user_id = $1;
\ No newline at end of file
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+  AND hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+  AND hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+SELECT chirps.*, ts_rank(chirps.search_vector, tsq)::real AS rank
+FROM chirps, websearch_to_tsquery('english', sqlc.arg('search')) AS tsq
+WHERE chirps.search_vector @@ tsq
+  AND chirps.hidden_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('author_id'))
+  AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('since'))
+  AND (sqlc.narg('until')::timestamp IS NULL OR chirps.created_at < sqlc.narg('until'))
+  AND (sqlc.narg('after_rank')::real IS NULL
+       OR (ts_rank(chirps.search_vector, tsq), chirps.created_at, chirps.id)
+          < (sqlc.narg('after_rank')::real, sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, in_reply_to) AS (
+    SELECT c.id, c.in_reply_to FROM chirps c WHERE c.id = $1
+    UNION ALL
+    SELECT c.id, c.in_reply_to FROM chirps c JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT * FROM chirps
+WHERE chirps.id IN (SELECT ancestors.id FROM ancestors) AND chirps.id <> $1
+  AND chirps.hidden_at IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c WHERE c.in_reply_to = sqlc.arg('root_id')
+    UNION ALL
+    SELECT c.id FROM chirps c JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT * FROM chirps
+WHERE chirps.id IN (SELECT descendants.id FROM descendants)
+  AND chirps.hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (chirps.created_at, chirps.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: CountRepliesForChirps :many
+SELECT in_reply_to::uuid AS chirp_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE in_reply_to = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY in_reply_to;
\ No newline at end of file
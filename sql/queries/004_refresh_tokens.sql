@@ -1,13 +1,49 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, user_id, created_at, updated_at, expires_at)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO refresh_tokens (
+    token_hash, user_id, created_at, updated_at, expires_at, parent_token_hash,
+    session_id, session_created_at, device_label, user_agent, ip_address
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 RETURNING *;
 
 -- name: GetRefreshToken :one
-SELECT * FROM refresh_tokens WHERE token = $1;
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
 
 -- name: GetUserFromRefreshToken :one
-SELECT user_id FROM refresh_tokens WHERE token = $1;
+SELECT user_id FROM refresh_tokens WHERE token_hash = $1;
 
 -- name: RevokeRefreshToken :exec
-UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token = $1;
\ No newline at end of file
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token_hash = $1;
+
+-- name: ListSessions :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND session_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET rotated_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+WITH RECURSIVE ancestors AS (
+    SELECT token_hash, parent_token_hash FROM refresh_tokens WHERE token_hash = $1
+    UNION ALL
+    SELECT r.token_hash, r.parent_token_hash FROM refresh_tokens r
+    JOIN ancestors a ON r.token_hash = a.parent_token_hash
+), family AS (
+    SELECT token_hash FROM ancestors WHERE parent_token_hash IS NULL
+    UNION ALL
+    SELECT r.token_hash FROM refresh_tokens r
+    JOIN family f ON r.parent_token_hash = f.token_hash
+)
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW()
+WHERE token_hash IN (SELECT token_hash FROM family) AND revoked_at IS NULL;
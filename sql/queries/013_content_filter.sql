@@ -0,0 +1,23 @@
+-- name: ListFilterRules :many
+SELECT * FROM filter_rules ORDER BY word ASC;
+
+-- name: UpsertFilterRule :one
+INSERT INTO filter_rules (id, word, action, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
+ON CONFLICT (word) DO UPDATE SET action = EXCLUDED.action, updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules WHERE id = $1;
+
+-- name: UpsertChirpFlag :exec
+INSERT INTO chirp_flags (chirp_id, reason, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (chirp_id) DO UPDATE SET reason = EXCLUDED.reason, created_at = NOW();
+
+-- name: ListChirpFlags :many
+SELECT * FROM chirp_flags
+WHERE (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, chirp_id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, chirp_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,26 @@
+-- name: SetTotpSecret :exec
+UPDATE users SET totp_secret = $2, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableTotp :exec
+UPDATE users SET totp_enabled = TRUE, totp_last_step = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: DisableTotp :exec
+UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTotpStep :execrows
+UPDATE users SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash)
+VALUES ($1, $2);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
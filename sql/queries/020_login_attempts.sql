@@ -0,0 +1,25 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (email, user_id, ip_address, user_agent, outcome)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetLoginThrottle :one
+SELECT failures, last_failure_at FROM login_throttles
+WHERE key = $1 AND expires_at > $2;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_throttles (key, failures, last_failure_at, expires_at)
+VALUES ($1, 1, $2, $3)
+ON CONFLICT (key) DO UPDATE SET
+    failures = CASE
+        WHEN login_throttles.expires_at > EXCLUDED.last_failure_at THEN login_throttles.failures + 1
+        ELSE 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at,
+    expires_at = EXCLUDED.expires_at
+RETURNING failures, last_failure_at;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttles WHERE key = $1;
+
+-- name: DeleteExpiredLoginThrottles :exec
+DELETE FROM login_throttles WHERE expires_at <= $1;
@@ -0,0 +1,21 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+VALUES ($1, $2, NOW() + interval '1 hour');
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: DeletePasswordResetTokens :exec
+DELETE FROM password_reset_tokens WHERE user_id = $1;
+
+-- name: UpdateUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: HasRecentPasswordResetToken :one
+SELECT EXISTS (
+    SELECT 1 FROM password_reset_tokens
+    WHERE user_id = $1 AND used_at IS NULL AND created_at > NOW() - interval '5 minutes'
+);
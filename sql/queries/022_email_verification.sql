@@ -0,0 +1,20 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, NOW() + interval '1 day');
+
+-- name: UseEmailVerificationToken :one
+DELETE FROM email_verification_tokens
+WHERE token_hash = $1 AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: DeleteEmailVerificationTokens :exec
+DELETE FROM email_verification_tokens WHERE user_id = $1;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1 AND email = $2;
+
+-- name: GetEmailVerificationCooldown :one
+SELECT CEIL(GREATEST(0, EXTRACT(EPOCH FROM MAX(created_at) + interval '5 minutes' - NOW())))::int AS wait_seconds
+FROM email_verification_tokens
+WHERE user_id = $1;
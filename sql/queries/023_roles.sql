@@ -0,0 +1,10 @@
+-- name: ListUserRoles :many
+SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role;
+
+-- name: GrantUserRole :exec
+INSERT INTO user_roles (user_id, role)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: RevokeUserRole :execrows
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2;
@@ -0,0 +1,33 @@
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE (sqlc.narg('email')::text IS NULL OR email ILIKE '%' || sqlc.narg('email')::text || '%')
+  AND (sqlc.narg('is_chirpy_red')::boolean IS NULL OR is_chirpy_red = sqlc.narg('is_chirpy_red'))
+  AND (sqlc.narg('suspended')::boolean IS NULL OR (suspended_at IS NOT NULL) = sqlc.narg('suspended'))
+  AND (sqlc.narg('created_since')::timestamp IS NULL OR created_at >= sqlc.narg('created_since'))
+  AND (sqlc.narg('created_until')::timestamp IS NULL OR created_at < sqlc.narg('created_until'))
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetUserSuspension :one
+SELECT suspended_at FROM users WHERE id = $1;
+
+-- name: SuspendUser :one
+UPDATE users SET
+    suspended_at = COALESCE(suspended_at, NOW()),
+    suspension_reason = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users SET
+    suspended_at = NULL,
+    suspension_reason = NULL,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1;
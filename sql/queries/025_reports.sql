@@ -0,0 +1,63 @@
+-- name: CreateReport :one
+INSERT INTO reports (chirp_id, reporter_id, reason, details)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (chirp_id, reporter_id) WHERE status = 'open' DO NOTHING
+RETURNING *;
+
+-- name: HasDismissedReport :one
+SELECT EXISTS (
+    SELECT 1 FROM reports
+    WHERE chirp_id = $1 AND reporter_id = $2 AND status = 'dismissed'
+);
+
+-- name: CountOpenReports :one
+SELECT COUNT(*) FROM reports WHERE chirp_id = $1 AND status = 'open';
+
+-- name: GetReportForUpdate :one
+SELECT * FROM reports WHERE id = $1 FOR UPDATE;
+
+-- name: ListReports :many
+SELECT reports.*,
+       chirps.user_id AS chirp_author_id,
+       chirps.body AS chirp_body,
+       chirps.hidden_at AS chirp_hidden_at,
+       (SELECT COUNT(*) FROM reports AS open_reports
+        WHERE open_reports.chirp_id = reports.chirp_id AND open_reports.status = 'open') AS open_report_count
+FROM reports
+LEFT JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = sqlc.arg('status')
+  AND (sqlc.narg('reason')::text IS NULL OR reports.reason = sqlc.narg('reason'))
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (reports.created_at, reports.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY reports.created_at ASC, reports.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ResolveChirpReports :execrows
+UPDATE reports SET
+    status = sqlc.arg('status'),
+    resolved_at = NOW(),
+    resolved_by = sqlc.narg('resolved_by')
+WHERE chirp_id = sqlc.arg('chirp_id') AND status = 'open';
+
+-- name: ResolveReport :exec
+UPDATE reports SET
+    status = sqlc.arg('status'),
+    resolved_at = NOW(),
+    resolved_by = sqlc.narg('resolved_by')
+WHERE id = sqlc.arg('id');
+
+-- name: HideChirp :execrows
+UPDATE chirps SET hidden_at = NOW() WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: UnhideChirp :exec
+UPDATE chirps SET hidden_at = NULL WHERE id = $1;
+
+-- name: CreateModerationAction :exec
+INSERT INTO moderation_actions (moderator_id, action, report_id, chirp_id, target_user_id, note)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetLatestHideAction :one
+SELECT action FROM moderation_actions
+WHERE chirp_id = $1 AND action IN ('auto_hide', 'hide_chirp')
+ORDER BY created_at DESC
+LIMIT 1;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- quote_of deliberately has no foreign key: a quote outlives the chirp it
+-- quotes and shows a tombstone in its place.
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID NULL REFERENCES chirps(id) ON DELETE CASCADE,
+ADD COLUMN quote_of UUID NULL;
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_key ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+DROP INDEX chirps_user_id_rechirp_of_key;
+ALTER TABLE chirps
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of;
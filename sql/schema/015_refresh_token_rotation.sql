@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    ADD COLUMN parent_token TEXT NULL REFERENCES refresh_tokens(token) ON DELETE SET NULL,
+    ADD COLUMN rotated_at TIMESTAMP NULL;
+CREATE INDEX refresh_tokens_parent_token_idx ON refresh_tokens (parent_token);
+
+-- +goose Down
+DROP INDEX refresh_tokens_parent_token_idx;
+ALTER TABLE refresh_tokens
+    DROP COLUMN rotated_at,
+    DROP COLUMN parent_token;
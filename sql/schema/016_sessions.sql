@@ -0,0 +1,20 @@
+-- +goose Up
+-- A session is a chain of rotated refresh tokens. Every token of the chain
+-- carries the session ID and the time the session started.
+ALTER TABLE refresh_tokens
+    ADD COLUMN session_id UUID NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN session_created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN device_label TEXT NOT NULL DEFAULT '',
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+UPDATE refresh_tokens SET session_created_at = created_at;
+CREATE INDEX refresh_tokens_user_session_idx ON refresh_tokens (user_id, session_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_session_idx;
+ALTER TABLE refresh_tokens
+    DROP COLUMN ip_address,
+    DROP COLUMN user_agent,
+    DROP COLUMN device_label,
+    DROP COLUMN session_created_at,
+    DROP COLUMN session_id;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Replace every stored refresh token by its SHA-256 digest. Tokens and parent
+-- links are rewritten in one statement so the foreign key still holds when it
+-- is checked at the end of it.
+UPDATE refresh_tokens SET
+    token = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+    parent_token = encode(sha256(convert_to(parent_token, 'UTF8')), 'hex');
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE refresh_tokens RENAME COLUMN parent_token TO parent_token_hash;
+
+-- +goose Down
+-- Digests cannot be turned back into tokens, so every session is dropped and
+-- users have to log in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN parent_token_hash TO parent_token;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
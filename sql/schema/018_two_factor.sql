@@ -0,0 +1,24 @@
+-- +goose Up
+-- totp_secret is encrypted with TOTP_KEY. It is set when enrollment starts and
+-- only used for logins once totp_enabled is true. totp_last_step is the time
+-- step of the last accepted code, so that a code cannot be used twice.
+ALTER TABLE users
+    ADD COLUMN totp_secret BYTEA NULL,
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP NULL,
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+ALTER TABLE users
+    DROP COLUMN totp_last_step,
+    DROP COLUMN totp_enabled,
+    DROP COLUMN totp_secret;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL
+);
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Every account'),
+    ('moderator', 'Can remove other people''s chirps and review flagged content'),
+    ('admin', 'Can manage users, roles, the content filter and metrics');
+
+-- Every account has the user role, so only the roles granted on top of it
+-- are stored.
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL REFERENCES roles(name),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+
+-- +goose Down
+DROP TABLE user_roles;
+DROP TABLE roles;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN suspended_at TIMESTAMP NULL,
+    ADD COLUMN suspension_reason TEXT NULL;
+
+CREATE INDEX users_created_at_id_idx ON users (created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX users_created_at_id_idx;
+ALTER TABLE users
+    DROP COLUMN suspension_reason,
+    DROP COLUMN suspended_at;
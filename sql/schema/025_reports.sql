@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP NULL;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'sexual', 'misinformation', 'other')),
+    details TEXT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP NULL,
+    resolved_by UUID NULL REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- A user has at most one open report per chirp, so that counting open reports
+-- counts distinct reporters.
+CREATE UNIQUE INDEX reports_open_reporter_idx ON reports (chirp_id, reporter_id) WHERE status = 'open';
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at, id);
+
+-- The audit log of moderation. It has no foreign keys so that it outlives the
+-- chirps and users it mentions. moderator_id is NULL for automatic actions.
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    moderator_id UUID NULL,
+    action TEXT NOT NULL,
+    report_id UUID NULL,
+    chirp_id UUID NULL,
+    target_user_id UUID NULL,
+    note TEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+ALTER TABLE chirps DROP COLUMN hidden_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Reports outlive the chirps they are about, so that the moderation queue
+-- keeps its history when a chirp is deleted.
+ALTER TABLE reports
+    ALTER COLUMN chirp_id DROP NOT NULL,
+    DROP CONSTRAINT reports_chirp_id_fkey,
+    ADD CONSTRAINT reports_chirp_id_fkey FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE SET NULL;
+
+-- +goose Down
+DELETE FROM reports WHERE chirp_id IS NULL;
+ALTER TABLE reports
+    DROP CONSTRAINT reports_chirp_id_fkey,
+    ADD CONSTRAINT reports_chirp_id_fkey FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    ALTER COLUMN chirp_id SET NOT NULL;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Rules added through the API used to be stored in upper case. When the same
+-- word is stored in both cases, the rule changed last wins.
+DELETE FROM filter_rules older USING filter_rules newer
+WHERE older.id <> newer.id
+  AND LOWER(older.word) = LOWER(newer.word)
+  AND (older.updated_at, older.id) < (newer.updated_at, newer.id);
+UPDATE filter_rules SET word = LOWER(word);
+
+-- +goose Down
+-- Lower case words match exactly like the upper case ones did, so there is
+-- nothing to undo.